@@ -1,57 +1,497 @@
 package enterprise
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os/signal"
+	"runtime/pprof"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/einherij/enterprise/health"
+	"github.com/einherij/enterprise/logging"
 )
 
 type Application interface {
-	Run()
+	Run() error
 	RegisterRunner(runner Runner)
+	RegisterNamedRunner(name string, runner Runner, opts ...RunnerOption)
 	RegisterOnRun(f func())
 	RegisterOnShutdown(f func())
 }
 
+// defaultShutdownTimeout is less than default kubernetes termination grace period,
+// so stuck runners are reported before the pod is killed
+const defaultShutdownTimeout = 25 * time.Second
+
+var ErrShutdownTimeout = errors.New("shutdown timeout exceeded")
+
 type App struct {
-	runners []Runner
+	runners         []*appRunner
+	shutdownTimeout time.Duration
+	health          *health.Registry
+	log             logging.Logger
+
+	statesMux sync.RWMutex
+	states    []*runnerState
+}
+
+// AppOption configures App
+type AppOption func(app *App)
+
+// WithShutdownTimeout sets total time budget for stopping all runners, zero means no limit
+func WithShutdownTimeout(timeout time.Duration) AppOption {
+	return func(app *App) {
+		app.shutdownTimeout = timeout
+	}
 }
 
-func NewApplication() *App {
-	return new(App)
+// WithHealthRegistry sets registry for runners health checks, health.DefaultRegistry is used by default
+func WithHealthRegistry(registry *health.Registry) AppOption {
+	return func(app *App) {
+		app.health = registry
+	}
+}
+
+// WithLogger sets logger for application and runners lifecycle events
+func WithLogger(logger logging.Logger) AppOption {
+	return func(app *App) {
+		app.log = logger
+	}
+}
+
+type appRunner struct {
+	name            string
+	runner          Runner
+	dependsOn       []string
+	shutdownTimeout time.Duration
+	nonCritical     bool
+}
+
+// RunnerOption configures the way App runs a registered runner
+type RunnerOption func(r *appRunner)
+
+// DependsOn makes the runner start after the named runners are ready and stop before them
+func DependsOn(names ...string) RunnerOption {
+	return func(r *appRunner) {
+		r.dependsOn = append(r.dependsOn, names...)
+	}
+}
+
+// ShutdownTimeout limits time the runner has for stopping after its context is cancelled,
+// when it's exceeded the runner is reported as stuck and its dependencies are stopped without waiting for it
+func ShutdownTimeout(timeout time.Duration) RunnerOption {
+	return func(r *appRunner) {
+		r.shutdownTimeout = timeout
+	}
+}
+
+// NonCritical makes App only log the runner error instead of shutting down the application
+func NonCritical() RunnerOption {
+	return func(r *appRunner) {
+		r.nonCritical = true
+	}
+}
+
+func NewApplication(opts ...AppOption) *App {
+	app := &App{
+		shutdownTimeout: defaultShutdownTimeout,
+		health:          health.DefaultRegistry,
+		log:             logging.Component("app"),
+	}
+	for _, opt := range opts {
+		opt(app)
+	}
+	return app
 }
 
 func (app *App) RegisterRunner(service Runner) {
-	app.runners = append(app.runners, service)
+	app.RegisterNamedRunner(fmt.Sprintf("unnamed_runner_%d", len(app.runners)), service)
+}
+
+func (app *App) RegisterNamedRunner(name string, service Runner, opts ...RunnerOption) {
+	r := &appRunner{
+		name:   name,
+		runner: service,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	app.runners = append(app.runners, r)
 }
 
 func (app *App) RegisterOnRun(f func()) {
-	app.runners = append(app.runners, RunnerFunc(f, func() {}))
+	app.RegisterRunner(RunnerFunc(f, func() {}))
 }
 
 func (app *App) RegisterOnShutdown(f func()) {
-	app.runners = append(app.runners, RunnerFunc(func() {}, f))
+	app.RegisterRunner(RunnerFunc(func() {}, f))
 }
 
-func (app *App) Run() {
+// Run starts runners in dependency order and waits for SIGTERM or SIGINT,
+// then stops runners in reverse order: every runner is stopped only after all its dependants are stopped.
+// Returns error without starting anything if runners have unknown dependencies or dependency cycles.
+// If a critical runner returns error the application is shut down as on signal.
+// Every runner has a readiness check in the health registry, readiness fails as soon as shutdown begins.
+// Returns joined errors of critical runners and ErrShutdownTimeout if some runners are still alive after the shutdown timeout.
+func (app *App) Run() error {
+	ordered, err := app.startupOrder()
+	if err != nil {
+		return fmt.Errorf("error ordering runners: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	ctx, fail := context.WithCancel(ctx)
+	defer fail()
+
 	var (
-		wg     sync.WaitGroup
-		ctx, _ = signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+		states = make([]*runnerState, 0, len(ordered))
+		byName = make(map[string]*runnerState, len(ordered))
 	)
-	logrus.Info("starting application")
-	for _, runnerService := range app.runners {
-		serviceRunner := runnerService
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			serviceRunner.Run(ctx)
-		}()
+	app.log.Info("starting application")
+	for _, r := range ordered {
+		state := newRunnerState(r, fail, app.log.WithField("runner", r.name))
+		for _, dep := range r.dependsOn {
+			state.dependencies = append(state.dependencies, byName[dep])
+			byName[dep].dependants = append(byName[dep].dependants, state)
+		}
+		states = append(states, state)
+		byName[r.name] = state
+		app.registerHealthCheck(state)
+	}
+	app.statesMux.Lock()
+	app.states = states
+	app.statesMux.Unlock()
+	for _, state := range states {
+		go state.run()
 	}
 
 	<-ctx.Done()
-	logrus.Info("shutting down application")
-	wg.Wait()
+	app.log.Info("shutting down application")
+	app.health.SetShuttingDown()
+	shutdownErr := app.shutdown(states)
+
+	var errs []error
+	for _, state := range states {
+		if err := state.error(); err != nil && !state.nonCritical {
+			errs = append(errs, err)
+		}
+	}
+	if shutdownErr != nil {
+		errs = append(errs, shutdownErr)
+	}
+	return errors.Join(errs...)
+}
+
+func (app *App) registerHealthCheck(state *runnerState) {
+	var opts []health.Option
+	if state.nonCritical {
+		opts = append(opts, health.NonCritical())
+	}
+	app.health.Register("runner_"+state.name, state.healthCheck, opts...)
+}
+
+func (app *App) shutdown(states []*runnerState) error {
+	var allStopped = make(chan struct{})
+	for _, state := range states {
+		go state.stopAfterDependants()
+	}
+	go func() {
+		defer close(allStopped)
+		for _, state := range states {
+			<-state.stopped
+		}
+	}()
+
+	var timeout <-chan time.Time
+	if app.shutdownTimeout > 0 {
+		timer := time.NewTimer(app.shutdownTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-allStopped:
+	case <-timeout:
+		app.log.Errorf("application hasn't stopped in %v", app.shutdownTimeout)
+	}
+
+	var alive []string
+	for _, state := range states {
+		select {
+		case <-state.done:
+		default:
+			alive = append(alive, state.name)
+		}
+	}
+	if len(alive) == 0 {
+		return nil
+	}
+	app.log.Errorf("runners are still alive after shutdown: %s", strings.Join(alive, ", "))
+	var dump bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&dump, 2); err != nil {
+		app.log.Errorf("error dumping goroutines: %v", err)
+	} else {
+		app.log.Errorf("goroutines dump:\n%s", dump.String())
+	}
+	return fmt.Errorf("%w: alive runners %s", ErrShutdownTimeout, strings.Join(alive, ", "))
+}
+
+// HealthRegistry returns registry where runners health checks are registered
+func (app *App) HealthRegistry() *health.Registry {
+	return app.health
+}
+
+type RunnerStatus string
+
+const (
+	RunnerRegistered RunnerStatus = "registered"
+	RunnerStarting   RunnerStatus = "starting"
+	RunnerRunning    RunnerStatus = "running"
+	RunnerStopping   RunnerStatus = "stopping"
+	RunnerStopped    RunnerStatus = "stopped"
+	RunnerFailed     RunnerStatus = "failed"
+)
+
+type RunnerInfo struct {
+	Name      string       `json:"name"`
+	DependsOn []string     `json:"depends_on,omitempty"`
+	Critical  bool         `json:"critical"`
+	Status    RunnerStatus `json:"status"`
+	Error     string       `json:"error,omitempty"`
+}
+
+// Runners returns current state of every registered runner in startup order if the application is running
+func (app *App) Runners() []RunnerInfo {
+	app.statesMux.RLock()
+	states := app.states
+	app.statesMux.RUnlock()
+
+	var infos []RunnerInfo
+	if states == nil {
+		for _, r := range app.runners {
+			infos = append(infos, r.info(RunnerRegistered))
+		}
+		return infos
+	}
+	for _, state := range states {
+		info := state.info(state.status())
+		if err := state.error(); err != nil {
+			info.Error = err.Error()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func (r *appRunner) info(status RunnerStatus) RunnerInfo {
+	return RunnerInfo{
+		Name:      r.name,
+		DependsOn: r.dependsOn,
+		Critical:  !r.nonCritical,
+		Status:    status,
+	}
+}
+
+// startupOrder sorts runners topologically keeping registration order for independent runners
+func (app *App) startupOrder() ([]*appRunner, error) {
+	var (
+		byName   = make(map[string]*appRunner, len(app.runners))
+		inDegree = make(map[string]int, len(app.runners))
+	)
+	for _, r := range app.runners {
+		if _, ok := byName[r.name]; ok {
+			return nil, fmt.Errorf("runner %q is registered more than once", r.name)
+		}
+		byName[r.name] = r
+	}
+	for _, r := range app.runners {
+		for _, dep := range r.dependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("runner %q depends on unknown runner %q", r.name, dep)
+			}
+		}
+		inDegree[r.name] = len(r.dependsOn)
+	}
+
+	var ordered = make([]*appRunner, 0, len(app.runners))
+	for len(ordered) < len(app.runners) {
+		var next *appRunner
+		for _, r := range app.runners {
+			if inDegree[r.name] == 0 {
+				next = r
+				break
+			}
+		}
+		if next == nil {
+			var cycled []string
+			for _, r := range app.runners {
+				if inDegree[r.name] > 0 {
+					cycled = append(cycled, r.name)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between runners %v", cycled)
+		}
+		inDegree[next.name] = -1
+		for _, r := range app.runners {
+			for _, dep := range r.dependsOn {
+				if dep == next.name {
+					inDegree[r.name]--
+				}
+			}
+		}
+		ordered = append(ordered, next)
+	}
+	return ordered, nil
+}
+
+type runnerState struct {
+	*appRunner
+
+	log    logging.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+	fail   context.CancelFunc // shuts down the application
+
+	errMux sync.Mutex
+	err    error
+
+	ready   chan struct{} // closed when dependants can be started
+	done    chan struct{} // closed when runner is finished or won't be started
+	stopped chan struct{} // closed when runner is finished or its shutdown timeout is exceeded
+
+	dependencies []*runnerState
+	dependants   []*runnerState
+}
+
+func newRunnerState(r *appRunner, fail context.CancelFunc, log logging.Logger) *runnerState {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &runnerState{
+		appRunner: r,
+		log:       log,
+		ctx:       ctx,
+		cancel:    cancel,
+		fail:      fail,
+		ready:     make(chan struct{}),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+}
+
+func (s *runnerState) run() {
+	defer close(s.done)
+	for _, dep := range s.dependencies {
+		select {
+		case <-dep.ready:
+		case <-s.ctx.Done():
+			s.log.Infof("runner is not started: shutdown before %s is ready", dep.name)
+			return
+		}
+	}
+
+	s.log.Info("starting runner")
+	go s.awaitReady()
+	if runnerE, ok := s.runner.(RunnerE); ok {
+		if err := runnerE.RunE(s.ctx); err != nil {
+			s.setError(err)
+			return
+		}
+	} else {
+		s.runner.Run(s.ctx)
+	}
+	s.log.Info("runner is stopped")
+}
+
+func (s *runnerState) setError(err error) {
+	s.errMux.Lock()
+	s.err = fmt.Errorf("runner %s failed: %w", s.name, err)
+	s.errMux.Unlock()
+
+	if s.nonCritical {
+		s.log.Errorf("non-critical %v", s.err)
+		return
+	}
+	s.log.Errorf("critical %v", s.err)
+	s.fail()
+}
+
+func (s *runnerState) error() error {
+	s.errMux.Lock()
+	defer s.errMux.Unlock()
+	return s.err
+}
+
+func (s *runnerState) awaitReady() {
+	if notifier, ok := s.runner.(ReadyNotifier); ok {
+		select {
+		case <-notifier.Ready():
+		case <-s.done:
+			return
+		case <-s.ctx.Done():
+			return
+		}
+	}
+	close(s.ready)
+}
+
+func (s *runnerState) status() RunnerStatus {
+	select {
+	case <-s.done:
+		if s.error() != nil {
+			return RunnerFailed
+		}
+		return RunnerStopped
+	default:
+	}
+	if s.ctx.Err() != nil {
+		return RunnerStopping
+	}
+	select {
+	case <-s.ready:
+		return RunnerRunning
+	default:
+		return RunnerStarting
+	}
+}
+
+func (s *runnerState) healthCheck(ctx context.Context) error {
+	select {
+	case <-s.done:
+		return errors.New("runner is stopped")
+	default:
+	}
+	select {
+	case <-s.ready:
+	default:
+		return errors.New("runner is not ready")
+	}
+	if checker, ok := s.runner.(health.Checker); ok {
+		return checker.HealthCheck(ctx)
+	}
+	return nil
+}
+
+func (s *runnerState) stopAfterDependants() {
+	defer close(s.stopped)
+	for _, dependant := range s.dependants {
+		<-dependant.stopped
+	}
+	s.log.Info("stopping runner")
+	s.cancel()
+
+	var timeout <-chan time.Time
+	if s.shutdownTimeout > 0 {
+		timer := time.NewTimer(s.shutdownTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-s.done:
+	case <-timeout:
+		s.log.Errorf("runner hasn't stopped in %v", s.shutdownTimeout)
+	}
 }
@@ -4,6 +4,8 @@
 package enterprise
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"syscall"
 	"testing"
@@ -12,13 +14,15 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/einherij/enterprise/health"
 	mock_runner "github.com/einherij/enterprise/mocks/runner"
 )
 
 type ApplicationSuite struct {
 	suite.Suite
 
-	app *App
+	app      *App
+	registry *health.Registry
 
 	ctrl       *gomock.Controller
 	mockRunner *mock_runner.MockRunner
@@ -31,7 +35,8 @@ func TestWebApplication(t *testing.T) {
 func (s *ApplicationSuite) SetupTest() {
 	s.ctrl = gomock.NewController(s.T())
 	s.mockRunner = mock_runner.NewMockRunner(s.ctrl)
-	s.app = NewApplication()
+	s.registry = health.NewRegistry()
+	s.app = NewApplication(WithHealthRegistry(s.registry))
 }
 
 func (s *ApplicationSuite) TearDownTest() {
@@ -42,7 +47,14 @@ func (s *ApplicationSuite) TestRegisterRunner() {
 	s.Len(s.app.runners, 0)
 	s.app.RegisterRunner(s.mockRunner)
 	s.Len(s.app.runners, 1)
-	s.Equal(s.mockRunner, s.app.runners[0])
+	s.Equal(s.mockRunner, s.app.runners[0].runner)
+}
+
+func (s *ApplicationSuite) TestRunnersBeforeRun() {
+	s.app.RegisterNamedRunner("http", s.mockRunner, DependsOn("db"), NonCritical())
+	s.Equal([]RunnerInfo{
+		{Name: "http", DependsOn: []string{"db"}, Critical: false, Status: RunnerRegistered},
+	}, s.app.Runners())
 }
 
 func (s *ApplicationSuite) TestRegisterOnShutdown() {
@@ -68,7 +80,241 @@ func (s *ApplicationSuite) TestRunAndShutdownBySyscall() {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		s.app.Run()
+		s.NoError(s.app.Run())
 	}()
 	wg.Wait()
 }
+
+type readyRunner struct {
+	Runner
+	ready chan struct{}
+}
+
+func (r *readyRunner) Ready() <-chan struct{} {
+	return r.ready
+}
+
+func (s *ApplicationSuite) TestRunInDependencyOrder() {
+	var (
+		mux     sync.Mutex
+		events  []string
+		started = make(chan struct{}, 3)
+	)
+	record := func(event string) {
+		mux.Lock()
+		defer mux.Unlock()
+		events = append(events, event)
+	}
+	newRunner := func(name string) Runner {
+		return NewRunner(name, func(ctx context.Context) {
+			record("start " + name)
+			started <- struct{}{}
+			<-ctx.Done()
+			record("stop " + name)
+		})
+	}
+	db := &readyRunner{Runner: newRunner("db"), ready: make(chan struct{})}
+	queue := &readyRunner{Runner: newRunner("queue"), ready: make(chan struct{})}
+
+	s.app.RegisterNamedRunner("http", newRunner("http"), DependsOn("db", "queue"))
+	s.app.RegisterNamedRunner("queue", queue, DependsOn("db"))
+	s.app.RegisterNamedRunner("db", db)
+
+	go func() {
+		<-started
+		time.Sleep(10 * time.Millisecond)
+		record("ready db")
+		close(db.ready)
+		<-started
+		close(queue.ready)
+		<-started
+		s.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGINT))
+	}()
+	s.NoError(s.app.Run())
+
+	s.Equal([]string{
+		"start db", "ready db", "start queue", "start http",
+		"stop http", "stop queue", "stop db",
+	}, events)
+}
+
+func (s *ApplicationSuite) TestRunWithUnknownDependency() {
+	s.app.RegisterNamedRunner("http", s.mockRunner, DependsOn("db"))
+	s.ErrorContains(s.app.Run(), `runner "http" depends on unknown runner "db"`)
+}
+
+func (s *ApplicationSuite) TestRunWithDependencyCycle() {
+	s.app.RegisterNamedRunner("first", mock_runner.NewMockRunner(s.ctrl), DependsOn("third"))
+	s.app.RegisterNamedRunner("second", mock_runner.NewMockRunner(s.ctrl), DependsOn("first"))
+	s.app.RegisterNamedRunner("third", mock_runner.NewMockRunner(s.ctrl), DependsOn("second"))
+	s.app.RegisterNamedRunner("independent", s.mockRunner)
+	s.ErrorContains(s.app.Run(), "dependency cycle between runners [first second third]")
+}
+
+func (s *ApplicationSuite) TestRunWithDuplicatedName() {
+	s.app.RegisterNamedRunner("http", s.mockRunner)
+	s.app.RegisterNamedRunner("http", mock_runner.NewMockRunner(s.ctrl))
+	s.ErrorContains(s.app.Run(), `runner "http" is registered more than once`)
+}
+
+func (s *ApplicationSuite) TestShutdownTimeout() {
+	var (
+		started = make(chan struct{}, 2)
+		release = make(chan struct{})
+	)
+	defer close(release)
+	s.app = NewApplication(WithHealthRegistry(s.registry), WithShutdownTimeout(50*time.Millisecond))
+	s.app.RegisterNamedRunner("stuck", NewRunner("stuck", func(ctx context.Context) {
+		started <- struct{}{}
+		<-release
+	}))
+	s.app.RegisterNamedRunner("graceful", NewRunner("graceful", func(ctx context.Context) {
+		started <- struct{}{}
+		<-ctx.Done()
+	}))
+
+	go func() {
+		<-started
+		<-started
+		s.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGINT))
+	}()
+	err := s.app.Run()
+	s.ErrorIs(err, ErrShutdownTimeout)
+	s.ErrorContains(err, "alive runners stuck")
+}
+
+func (s *ApplicationSuite) TestRunnerShutdownTimeout() {
+	var (
+		started        = make(chan struct{}, 2)
+		release        = make(chan struct{})
+		databaseClosed = make(chan struct{})
+	)
+	defer close(release)
+	s.app = NewApplication(WithHealthRegistry(s.registry), WithShutdownTimeout(time.Second))
+	s.app.RegisterNamedRunner("database", NewRunner("database", func(ctx context.Context) {
+		started <- struct{}{}
+		<-ctx.Done()
+		close(databaseClosed)
+	}))
+	s.app.RegisterNamedRunner("stuck", NewRunner("stuck", func(ctx context.Context) {
+		started <- struct{}{}
+		<-release
+	}), DependsOn("database"), ShutdownTimeout(50*time.Millisecond))
+
+	go func() {
+		<-started
+		<-started
+		s.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGINT))
+	}()
+	err := s.app.Run()
+	s.ErrorIs(err, ErrShutdownTimeout)
+	s.ErrorContains(err, "alive runners stuck")
+	s.Eventually(func() bool {
+		select {
+		case <-databaseClosed:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+}
+
+func (s *ApplicationSuite) TestCriticalRunnerFailure() {
+	var (
+		consumerErr = errors.New("consumer is dead")
+		httpStopped = make(chan struct{})
+	)
+	s.app.RegisterNamedRunner("consumer", NewRunnerE("consumer", func(ctx context.Context) error {
+		return consumerErr
+	}))
+	s.app.RegisterNamedRunner("http", NewRunner("http", func(ctx context.Context) {
+		<-ctx.Done()
+		close(httpStopped)
+	}))
+
+	err := s.app.Run()
+	s.ErrorIs(err, consumerErr)
+	s.ErrorContains(err, "runner consumer failed")
+	s.Eventually(func() bool {
+		select {
+		case <-httpStopped:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+}
+
+func (s *ApplicationSuite) TestNonCriticalRunnerFailure() {
+	var (
+		failed  = make(chan struct{})
+		started = make(chan struct{})
+	)
+	s.app.RegisterNamedRunner("cache_warmer", NewRunnerE("cache_warmer", func(ctx context.Context) error {
+		defer close(failed)
+		return errors.New("cache is not warmed")
+	}), NonCritical())
+	s.app.RegisterNamedRunner("http", NewRunner("http", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+	}))
+
+	go func() {
+		<-failed
+		<-started
+		time.Sleep(10 * time.Millisecond)
+		s.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGINT))
+	}()
+	s.NoError(s.app.Run())
+}
+
+func (s *ApplicationSuite) TestReadiness() {
+	var (
+		started       = make(chan struct{})
+		stopping      = make(chan struct{})
+		finishStop    = make(chan struct{})
+		readyRunner   = &readyRunner{Runner: NewRunner("db", func(ctx context.Context) { <-ctx.Done() }), ready: make(chan struct{})}
+		checkStatuses = func() (health.Status, map[string]health.Status) {
+			report := s.registry.Readiness(context.Background())
+			statuses := make(map[string]health.Status)
+			for _, check := range report.Checks {
+				statuses[check.Name] = check.Status
+			}
+			return report.Status, statuses
+		}
+	)
+	s.app.RegisterNamedRunner("db", readyRunner)
+	s.app.RegisterNamedRunner("http", NewRunner("http", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		close(stopping)
+		<-finishStop
+	}), DependsOn("db"))
+
+	go func() {
+		defer close(finishStop)
+		s.Eventually(func() bool {
+			_, statuses := checkStatuses()
+			return statuses["runner_db"] == health.StatusFailing && statuses["runner_http"] == health.StatusFailing
+		}, time.Second, time.Millisecond)
+
+		s.Equal(RunnerStarting, s.app.Runners()[0].Status)
+		close(readyRunner.ready)
+		<-started
+		s.Eventually(func() bool {
+			status, _ := checkStatuses()
+			return status == health.StatusOK
+		}, time.Second, time.Millisecond)
+
+		s.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGINT))
+		<-stopping
+		s.Equal([]RunnerInfo{
+			{Name: "db", Critical: true, Status: RunnerRunning},
+			{Name: "http", DependsOn: []string{"db"}, Critical: true, Status: RunnerStopping},
+		}, s.app.Runners())
+		status, statuses := checkStatuses()
+		s.Equal(health.StatusFailing, status)
+		s.Equal(health.StatusFailing, statuses["shutdown"])
+	}()
+	s.NoError(s.app.Run())
+}
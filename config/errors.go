@@ -0,0 +1,39 @@
+package config
+
+import (
+	"strings"
+)
+
+// Problem describes a missing or invalid config key
+type Problem struct {
+	Key     string
+	Source  string
+	Message string
+}
+
+func (p Problem) String() string {
+	var str = p.Key + ": " + p.Message
+	if p.Source != "" {
+		str += " (from " + p.Source + ")"
+	}
+	return str
+}
+
+// Error lists every problem found while loading config
+type Error struct {
+	Problems []Problem
+}
+
+func (e *Error) Error() string {
+	var report strings.Builder
+	report.WriteString("invalid config:")
+	for _, p := range e.Problems {
+		report.WriteString("\n\t")
+		report.WriteString(p.String())
+	}
+	return report.String()
+}
+
+func (e *Error) add(key, source, message string) {
+	e.Problems = append(e.Problems, Problem{Key: key, Source: source, Message: message})
+}
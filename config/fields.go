@@ -0,0 +1,190 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	keyTag      = "mapstructure"
+	defaultTag  = "default"
+	validateTag = "validate"
+
+	keySeparator = "."
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field is a leaf of config struct which value is loaded from sources
+type field struct {
+	key      string
+	path     []string
+	value    reflect.Value
+	def      string
+	hasDef   bool
+	validate string
+}
+
+// collectFields walks struct recursively, nested structs are addressed by dotted keys
+func collectFields(v reflect.Value, path []string) []*field {
+	var (
+		fields []*field
+		t      = v.Type()
+	)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(sf.Tag.Get(keyTag), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		fieldPath := append(append([]string(nil), path...), name)
+		if strings.Contains(opts, "squash") || sf.Anonymous && sf.Tag.Get(keyTag) == "" {
+			fieldPath = path
+		}
+
+		fv := v.Field(i)
+		if isNested(sf.Type) {
+			fields = append(fields, collectFields(fv, fieldPath)...)
+			continue
+		}
+		def, hasDef := sf.Tag.Lookup(defaultTag)
+		fields = append(fields, &field{
+			key:      strings.Join(fieldPath, keySeparator),
+			path:     fieldPath,
+			value:    fv,
+			def:      def,
+			hasDef:   hasDef,
+			validate: sf.Tag.Get(validateTag),
+		})
+	}
+	return fields
+}
+
+func isNested(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{})
+}
+
+// setValue converts raw value from file, environment or flag to the field type
+func setValue(v reflect.Value, raw any) error {
+	switch val := raw.(type) {
+	case nil:
+		return nil
+	case string:
+		return setString(v, val)
+	case []any:
+		if v.Kind() != reflect.Slice {
+			return fmt.Errorf("cannot use list as %s", v.Type())
+		}
+		slice := reflect.MakeSlice(v.Type(), len(val), len(val))
+		for i := range val {
+			if err := setValue(slice.Index(i), val[i]); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		v.Set(slice)
+		return nil
+	case map[string]any:
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("cannot use map as %s", v.Type())
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(val))
+		for key, elem := range val {
+			elemVal := reflect.New(v.Type().Elem()).Elem()
+			if err := setValue(elemVal, elem); err != nil {
+				return fmt.Errorf("key %s: %w", key, err)
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elemVal)
+		}
+		v.Set(m)
+		return nil
+	case float64:
+		return setString(v, strconv.FormatFloat(val, 'f', -1, 64))
+	case time.Time:
+		if v.Type() != reflect.TypeOf(time.Time{}) {
+			return fmt.Errorf("cannot use time as %s", v.Type())
+		}
+		v.Set(reflect.ValueOf(val))
+		return nil
+	default:
+		return setString(v, fmt.Sprint(val))
+	}
+}
+
+// setString parses value, lists are comma separated, maps are comma separated key=value pairs
+func setString(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []any
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return setValue(v, items)
+	case reflect.Map:
+		var pairs = make(map[string]any)
+		for _, pair := range strings.Split(s, ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value pair, got %q", pair)
+			}
+			pairs[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+		return setValue(v, pairs)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
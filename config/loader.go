@@ -0,0 +1,230 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const secretFileSuffix = "_FILE"
+
+// Loader fills config structs with mapstructure tags.
+// Sources are applied in order of precedence, each next source overrides the previous one:
+// default tags, files in the given order, environment variables, flags.
+type Loader struct {
+	files     []string
+	env       bool
+	envPrefix string
+	flags     *flag.FlagSet
+	args      []string
+
+	lookupEnv func(key string) (string, bool)
+	readFile  func(name string) ([]byte, error)
+}
+
+// Option configures Loader
+type Option func(l *Loader)
+
+// WithFiles adds YAML or JSON files, format is chosen by extension
+func WithFiles(paths ...string) Option {
+	return func(l *Loader) {
+		l.files = append(l.files, paths...)
+	}
+}
+
+// WithEnvPrefix enables environment variables, key postgres.host with prefix APP is read from APP_POSTGRES_HOST,
+// with empty prefix it's read from POSTGRES_HOST.
+// If APP_POSTGRES_HOST_FILE is set, the value is read from the file it points to.
+func WithEnvPrefix(prefix string) Option {
+	return func(l *Loader) {
+		l.env = true
+		l.envPrefix = prefix
+	}
+}
+
+// WithFlags defines flag for every config key in the flag set, e.g. -postgres.host, and parses args.
+// Only explicitly passed flags override other sources.
+func WithFlags(flags *flag.FlagSet, args []string) Option {
+	return func(l *Loader) {
+		l.flags = flags
+		l.args = args
+	}
+}
+
+func NewLoader(opts ...Option) *Loader {
+	l := &Loader{
+		lookupEnv: os.LookupEnv,
+		readFile:  os.ReadFile,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Load is a shortcut for NewLoader(opts...).Load(dst)
+func Load(dst any, opts ...Option) error {
+	return NewLoader(opts...).Load(dst)
+}
+
+// Load fills the struct dst points to, returns *Error listing every missing or invalid key
+func (l *Loader) Load(dst any) error {
+	ptr := reflect.ValueOf(dst)
+	if ptr.Kind() != reflect.Pointer || ptr.Elem().Kind() != reflect.Struct {
+		return errors.New("config destination is not a pointer to struct")
+	}
+	var (
+		fields  = collectFields(ptr.Elem(), nil)
+		loadErr = new(Error)
+	)
+
+	for _, f := range fields {
+		if f.hasDef {
+			if err := setString(f.value, f.def); err != nil {
+				loadErr.add(f.key, "default tag", err.Error())
+			}
+		}
+	}
+
+	for _, path := range l.files {
+		content, err := l.parseFile(path)
+		if err != nil {
+			loadErr.add(path, "file", err.Error())
+			continue
+		}
+		for _, f := range fields {
+			if raw, ok := lookupPath(content, f.path); ok {
+				if err := setValue(f.value, raw); err != nil {
+					loadErr.add(f.key, path, err.Error())
+				}
+			}
+		}
+	}
+
+	if l.env {
+		for _, f := range fields {
+			l.applyEnv(f, loadErr)
+		}
+	}
+
+	if l.flags != nil {
+		l.applyFlags(fields, loadErr)
+	}
+
+	for _, f := range fields {
+		for _, problem := range validate(f) {
+			loadErr.add(f.key, "", problem)
+		}
+	}
+
+	if len(loadErr.Problems) > 0 {
+		return loadErr
+	}
+	return nil
+}
+
+func (l *Loader) parseFile(path string) (map[string]any, error) {
+	data, err := l.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var content map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &content)
+	case ".json":
+		err = json.Unmarshal(data, &content)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file: %w", err)
+	}
+	return content, nil
+}
+
+// lookupPath finds value of nested key, key comparison is case-insensitive as in mapstructure
+func lookupPath(content map[string]any, path []string) (any, bool) {
+	var current any = content
+	for _, segment := range path {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		var found bool
+		for key, value := range m {
+			if strings.EqualFold(key, segment) {
+				current, found = value, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// EnvName returns environment variable name of the config key
+func EnvName(prefix, key string) string {
+	name := strings.ToUpper(strings.NewReplacer(keySeparator, "_", "-", "_").Replace(key))
+	if prefix == "" {
+		return name
+	}
+	return strings.ToUpper(prefix) + "_" + name
+}
+
+func (l *Loader) applyEnv(f *field, loadErr *Error) {
+	name := EnvName(l.envPrefix, f.key)
+	if value, ok := l.lookupEnv(name); ok {
+		if err := setString(f.value, value); err != nil {
+			loadErr.add(f.key, name, err.Error())
+		}
+		return
+	}
+	if secretPath, ok := l.lookupEnv(name + secretFileSuffix); ok {
+		secret, err := l.readFile(secretPath)
+		if err != nil {
+			loadErr.add(f.key, name+secretFileSuffix, err.Error())
+			return
+		}
+		if err := setString(f.value, strings.TrimRight(string(secret), "\r\n")); err != nil {
+			loadErr.add(f.key, name+secretFileSuffix, err.Error())
+		}
+	}
+}
+
+func (l *Loader) applyFlags(fields []*field, loadErr *Error) {
+	for _, f := range fields {
+		if l.flags.Lookup(f.key) == nil {
+			l.flags.String(f.key, f.def, "config key "+f.key)
+		}
+	}
+	if !l.flags.Parsed() {
+		if err := l.flags.Parse(l.args); err != nil {
+			loadErr.add("flags", "", err.Error())
+			return
+		}
+	}
+
+	var byKey = make(map[string]*field, len(fields))
+	for _, f := range fields {
+		byKey[f.key] = f
+	}
+	l.flags.Visit(func(fl *flag.Flag) {
+		f, ok := byKey[fl.Name]
+		if !ok {
+			return
+		}
+		if err := setString(f.value, fl.Value.String()); err != nil {
+			loadErr.add(f.key, "flag -"+fl.Name, err.Error())
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/einherij/enterprise/db"
+	"github.com/einherij/enterprise/db/message_queue"
+	"github.com/einherij/enterprise/logging"
+)
+
+type testConfig struct {
+	Postgres db.PostgresConfig         `mapstructure:"postgres"`
+	Kafka    message_queue.KafkaConfig `mapstructure:"kafka"`
+	Logging  logging.Config            `mapstructure:"logging"`
+	Limits   struct {
+		RPS     int           `mapstructure:"rps" validate:"min=1,max=1000"`
+		Timeout time.Duration `mapstructure:"timeout" default:"5s"`
+	} `mapstructure:"limits"`
+}
+
+type LoaderSuite struct {
+	suite.Suite
+
+	dir string
+	env map[string]string
+}
+
+func TestLoader(t *testing.T) {
+	suite.Run(t, new(LoaderSuite))
+}
+
+func (s *LoaderSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.env = make(map[string]string)
+}
+
+func (s *LoaderSuite) writeFile(name, content string) string {
+	path := filepath.Join(s.dir, name)
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func (s *LoaderSuite) load(cfg *testConfig, opts ...Option) error {
+	l := NewLoader(opts...)
+	l.lookupEnv = func(key string) (string, bool) {
+		v, ok := s.env[key]
+		return v, ok
+	}
+	return l.Load(cfg)
+}
+
+func (s *LoaderSuite) TestPrecedence() {
+	yamlPath := s.writeFile("config.yaml", `
+postgres:
+  host: yaml-host
+  username: yaml-user
+  database: yaml-db
+  port: "6432"
+kafka:
+  brokers: [kafka-1:9092, kafka-2:9092]
+logging:
+  level: debug
+  components:
+    postgres: warn
+limits:
+  rps: 100
+`)
+	jsonPath := s.writeFile("override.json", `{"postgres": {"username": "json-user"}, "limits": {"rps": 200}}`)
+	secretPath := s.writeFile("password", "secret\n")
+	s.env["APP_POSTGRES_HOST"] = "env-host"
+	s.env["APP_POSTGRES_PASSWORD_FILE"] = secretPath
+	s.env["APP_LIMITS_RPS"] = "300"
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	var cfg testConfig
+	s.NoError(s.load(&cfg,
+		WithFiles(yamlPath, jsonPath),
+		WithEnvPrefix("app"),
+		WithFlags(flags, []string{"-limits.rps=400", "-logging.format=json"}),
+	))
+
+	s.Equal(db.PostgresConfig{
+		Host:     "env-host",
+		Port:     "6432",
+		Username: "json-user",
+		Password: "secret",
+		DBName:   "yaml-db",
+	}, cfg.Postgres)
+	s.Equal([]string{"kafka-1:9092", "kafka-2:9092"}, cfg.Kafka.Brokers)
+	s.Equal(logging.Config{
+		Level:      "debug",
+		Format:     "json",
+		Components: map[string]string{"postgres": "warn"},
+	}, cfg.Logging)
+	s.Equal(400, cfg.Limits.RPS)
+	s.Equal(5*time.Second, cfg.Limits.Timeout)
+}
+
+func (s *LoaderSuite) TestEnvLists() {
+	s.env["POSTGRES_HOST"] = "localhost"
+	s.env["POSTGRES_USERNAME"] = "user"
+	s.env["POSTGRES_DATABASE"] = "db"
+	s.env["KAFKA_BROKERS"] = "kafka-1:9092, kafka-2:9092"
+	s.env["LOGGING_COMPONENTS"] = "postgres=debug,kafka=error"
+	s.env["LIMITS_RPS"] = "1"
+
+	var cfg testConfig
+	s.NoError(s.load(&cfg, WithEnvPrefix("")))
+	s.Equal([]string{"kafka-1:9092", "kafka-2:9092"}, cfg.Kafka.Brokers)
+	s.Equal(map[string]string{"postgres": "debug", "kafka": "error"}, cfg.Logging.Components)
+	s.Equal("5432", cfg.Postgres.Port)
+}
+
+func (s *LoaderSuite) TestReport() {
+	yamlPath := s.writeFile("config.yaml", `
+postgres:
+  host: localhost
+logging:
+  format: xml
+limits:
+  rps: 5000
+  timeout: forever
+`)
+
+	var cfg testConfig
+	err := s.load(&cfg, WithFiles(yamlPath, filepath.Join(s.dir, "missing.yaml")))
+	var configErr *Error
+	s.Require().True(errors.As(err, &configErr))
+	var keys []string
+	for _, p := range configErr.Problems {
+		keys = append(keys, p.Key)
+	}
+	s.ElementsMatch([]string{
+		"limits.timeout",
+		filepath.Join(s.dir, "missing.yaml"),
+		"postgres.username",
+		"postgres.database",
+		"kafka.brokers",
+		"logging.format",
+		"limits.rps",
+	}, keys)
+	s.Contains(err.Error(), "postgres.username: required value is missing")
+	s.Contains(err.Error(), `logging.format: value "xml" is not one of [text json]`)
+	s.Contains(err.Error(), "limits.rps: value 5000 is greater than 1000")
+}
+
+func (s *LoaderSuite) TestEnvName() {
+	s.Equal("APP_POSTGRES_HOST", EnvName("app", "postgres.host"))
+	s.Equal("LIVENESS_PORT", EnvName("", "liveness_port"))
+}
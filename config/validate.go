@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/einherij/enterprise/utils"
+)
+
+// validate checks rules of validate tag: required, oneof=a b c, min=N and max=N.
+// min and max limit numbers or length of strings, slices and maps.
+func validate(f *field) []string {
+	var problems []string
+	for _, rule := range strings.Split(f.validate, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "":
+		case "required":
+			if f.value.IsZero() {
+				problems = append(problems, "required value is missing")
+			}
+		case "oneof":
+			if f.value.IsZero() {
+				continue
+			}
+			allowed := strings.Fields(arg)
+			if actual := fmt.Sprint(f.value.Interface()); !utils.IsInSlice(actual, allowed) {
+				problems = append(problems, fmt.Sprintf("value %q is not one of %v", actual, allowed))
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("invalid %s rule %q", name, arg))
+				continue
+			}
+			actual, ok := measure(f.value)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s rule isn't applicable to %s", name, f.value.Type()))
+				continue
+			}
+			if name == "min" && actual < limit {
+				problems = append(problems, fmt.Sprintf("value %v is less than %v", actual, limit))
+			}
+			if name == "max" && actual > limit {
+				problems = append(problems, fmt.Sprintf("value %v is greater than %v", actual, limit))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("unknown validation rule %q", name))
+		}
+	}
+	return problems
+}
+
+func measure(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String, reflect.Slice, reflect.Map:
+		return float64(v.Len()), true
+	}
+	return 0, false
+}
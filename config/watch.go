@@ -0,0 +1,157 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/einherij/enterprise/logging"
+)
+
+const defaultWatchInterval = 5 * time.Second
+
+// Validator is implemented by configs which need validation beyond validate tags
+type Validator interface {
+	Validate() error
+}
+
+// Watcher keeps the current config and reloads it when config files change or SIGHUP is received.
+// Watcher is a runner, it's supposed to be registered in App.
+type Watcher[T any] struct {
+	loader   *Loader
+	log      logging.Logger
+	interval time.Duration
+
+	mux         sync.RWMutex
+	current     T
+	subscribers []func(old, new T)
+	fileStates  map[string]fileState
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch loads config with the loader options, returns error if the initial config is invalid
+func Watch[T any](opts ...Option) (*Watcher[T], error) {
+	w := &Watcher[T]{
+		loader:   NewLoader(opts...),
+		log:      logging.Component("config"),
+		interval: defaultWatchInterval,
+	}
+	cfg, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.current = cfg
+	w.fileStates = w.statFiles()
+	return w, nil
+}
+
+// SetInterval changes how often config files are checked for changes
+func (w *Watcher[T]) SetInterval(interval time.Duration) {
+	w.interval = interval
+}
+
+// Get returns the current config
+func (w *Watcher[T]) Get() T {
+	w.mux.RLock()
+	defer w.mux.RUnlock()
+	return w.current
+}
+
+// Subscribe adds function which is called with old and new config after every successful reload
+func (w *Watcher[T]) Subscribe(f func(old, new T)) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.subscribers = append(w.subscribers, f)
+}
+
+// Reload loads and validates config, the current config is kept if the new one is invalid
+func (w *Watcher[T]) Reload() error {
+	cfg, err := w.load()
+	if err != nil {
+		return err
+	}
+
+	w.mux.Lock()
+	old := w.current
+	w.current = cfg
+	subscribers := w.subscribers
+	w.mux.Unlock()
+
+	for _, notify := range subscribers {
+		notify(old, cfg)
+	}
+	return nil
+}
+
+func (w *Watcher[T]) load() (cfg T, err error) {
+	if err = w.loader.Load(&cfg); err != nil {
+		return cfg, err
+	}
+	if validator, ok := any(&cfg).(Validator); ok {
+		if err = validator.Validate(); err != nil {
+			return cfg, fmt.Errorf("invalid config: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// Run reloads config on SIGHUP and on config files changes until ctx is done
+func (w *Watcher[T]) Run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hangup:
+			w.log.Info("reloading config on SIGHUP")
+			w.reload()
+		case <-ticker.C:
+			if states := w.statFiles(); w.filesChanged(states) {
+				w.fileStates = states
+				w.log.Info("reloading config on files change")
+				w.reload()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *Watcher[T]) reload() {
+	if err := w.Reload(); err != nil {
+		w.log.Errorf("error reloading config, keeping the current one: %v", err)
+	}
+}
+
+func (w *Watcher[T]) statFiles() map[string]fileState {
+	var states = make(map[string]fileState, len(w.loader.files))
+	for _, path := range w.loader.files {
+		if info, err := os.Stat(path); err == nil {
+			states[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return states
+}
+
+func (w *Watcher[T]) filesChanged(states map[string]fileState) bool {
+	if len(states) != len(w.fileStates) {
+		return true
+	}
+	for path, state := range states {
+		if w.fileStates[path] != state {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type limitsConfig struct {
+	RPS   int `mapstructure:"rps" validate:"min=1"`
+	Burst int `mapstructure:"burst"`
+}
+
+func (c *limitsConfig) Validate() error {
+	if c.Burst != 0 && c.Burst < c.RPS {
+		return errors.New("burst is less than rps")
+	}
+	return nil
+}
+
+type WatcherSuite struct {
+	suite.Suite
+
+	path string
+}
+
+func TestWatcher(t *testing.T) {
+	suite.Run(t, new(WatcherSuite))
+}
+
+func (s *WatcherSuite) SetupTest() {
+	s.path = filepath.Join(s.T().TempDir(), "limits.yaml")
+	s.writeConfig("rps: 10")
+}
+
+func (s *WatcherSuite) writeConfig(content string) {
+	s.Require().NoError(os.WriteFile(s.path, []byte(content), 0o600))
+}
+
+func (s *WatcherSuite) TestReload() {
+	w, err := Watch[limitsConfig](WithFiles(s.path))
+	s.Require().NoError(err)
+	s.Equal(limitsConfig{RPS: 10}, w.Get())
+
+	var changes [][2]limitsConfig
+	w.Subscribe(func(old, new limitsConfig) {
+		changes = append(changes, [2]limitsConfig{old, new})
+	})
+
+	s.writeConfig("rps: 20")
+	s.NoError(w.Reload())
+	s.Equal(limitsConfig{RPS: 20}, w.Get())
+
+	s.writeConfig("rps: 0")
+	s.Error(w.Reload())
+	s.writeConfig("rps: 30\nburst: 10")
+	s.ErrorContains(w.Reload(), "burst is less than rps")
+	s.Equal(limitsConfig{RPS: 20}, w.Get())
+
+	s.Equal([][2]limitsConfig{{{RPS: 10}, {RPS: 20}}}, changes)
+}
+
+func (s *WatcherSuite) TestInvalidInitialConfig() {
+	s.writeConfig("rps: -1")
+	_, err := Watch[limitsConfig](WithFiles(s.path))
+	s.ErrorContains(err, "rps: value -1 is less than 1")
+}
+
+func (s *WatcherSuite) TestReloadOnFileChange() {
+	w, err := Watch[limitsConfig](WithFiles(s.path))
+	s.Require().NoError(err)
+	w.SetInterval(time.Millisecond)
+
+	var (
+		mux     sync.Mutex
+		updated limitsConfig
+	)
+	w.Subscribe(func(_, new limitsConfig) {
+		mux.Lock()
+		defer mux.Unlock()
+		updated = new
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	s.writeConfig("rps: 100\nburst: 200")
+	s.Eventually(func() bool {
+		mux.Lock()
+		defer mux.Unlock()
+		return updated == limitsConfig{RPS: 100, Burst: 200}
+	}, time.Second, time.Millisecond)
+	s.Equal(limitsConfig{RPS: 100, Burst: 200}, w.Get())
+}
@@ -10,8 +10,8 @@ import (
 type AWSConfig struct {
 	AccessKeyID     string `mapstructure:"access_key_id"`
 	SecretAccessKey string `mapstructure:"secret_access_key"`
-	Bucket          string `mapstructure:"bucket"`
-	Region          string `mapstructure:"region"`
+	Bucket          string `mapstructure:"bucket" validate:"required"`
+	Region          string `mapstructure:"region" validate:"required"`
 	// Used for minio as local aws
 	Local    bool   `mapstructure:"local"`
 	Endpoint string `mapstructure:"endpoint"`
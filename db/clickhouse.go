@@ -7,7 +7,8 @@ import (
 	"time"
 
 	_ "github.com/ClickHouse/clickhouse-go"
-	"github.com/sirupsen/logrus"
+
+	"github.com/einherij/enterprise/health"
 )
 
 const (
@@ -15,15 +16,16 @@ const (
 )
 
 type ClickhouseConfig struct {
-	Host     string `mapstructure:"host"`
-	Port     string `mapstructure:"port"`
+	Host     string `mapstructure:"host" validate:"required"`
+	Port     string `mapstructure:"port" default:"9000"`
 	DBName   string `mapstructure:"database"`
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
 	Debug    bool   `mapstructure:"debug"`
 }
 
-func NewClickHouseClient(cfg ClickhouseConfig) (*sql.DB, error) {
+func NewClickHouseClient(cfg ClickhouseConfig, opts ...Option) (*sql.DB, error) {
+	o := newOptions("clickhouse", opts)
 	cxDSN := fmt.Sprintf(
 		"tcp://%s:%s?username=%s&password=%s",
 		cfg.Host,
@@ -49,6 +51,12 @@ func NewClickHouseClient(cfg ClickhouseConfig) (*sql.DB, error) {
 			cfg.Host, cfg.Port, err,
 		)
 	}
-	logrus.Infof("connected to the clickhouse database at %s:%s", cfg.Host, cfg.Port)
+	o.log.Infof("connected to the clickhouse database at %s:%s", cfg.Host, cfg.Port)
+	o.registerHealthCheck(ClickHouseHealthCheck(cxDB))
 	return cxDB, nil
 }
+
+// ClickHouseHealthCheck pings the database, it's registered by NewClickHouseClient with WithHealthCheck option
+func ClickHouseHealthCheck(cxDB *sql.DB) health.Check {
+	return cxDB.PingContext
+}
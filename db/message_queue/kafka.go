@@ -1,16 +1,21 @@
 package message_queue
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
+	"net"
 	"strings"
 	"time"
 
 	"github.com/IBM/sarama"
+
+	"github.com/einherij/enterprise/health"
 )
 
 type KafkaConfig struct {
-	Brokers []string `mapstructure:"brokers"`
+	Brokers []string `mapstructure:"brokers" validate:"required"`
 }
 
 const (
@@ -37,8 +42,35 @@ func expRetry(initialTime time.Duration) func(int, int) time.Duration {
 	}
 }
 
+// KafkaOption configures kafka client
+type KafkaOption func(o *kafkaOptions)
+
+type kafkaOptions struct {
+	healthRegistry *health.Registry
+	healthName     string
+	healthOpts     []health.Option
+}
+
+// WithHealthCheck registers KafkaHealthCheck when client is created, health.DefaultRegistry is used if registry is nil.
+// Check is named "kafka" if name is empty, options set its timeout and criticality.
+func WithHealthCheck(registry *health.Registry, name string, opts ...health.Option) KafkaOption {
+	return func(o *kafkaOptions) {
+		if registry == nil {
+			registry = health.DefaultRegistry
+		}
+		if name == "" {
+			name = "kafka"
+		}
+		o.healthRegistry, o.healthName, o.healthOpts = registry, name, opts
+	}
+}
+
 // NewKafkaClient return new sarama.Client interface
-func NewKafkaClient(cfg KafkaConfig) (sarama.Client, error) {
+func NewKafkaClient(cfg KafkaConfig, opts ...KafkaOption) (sarama.Client, error) {
+	var o kafkaOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 	c := sarama.NewConfig()
 	c.Producer.Retry.Max = maxRetries
 	c.Producer.Return.Successes = returnSuccess
@@ -53,5 +85,43 @@ func NewKafkaClient(cfg KafkaConfig) (sarama.Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("[NewKafkaClient] Brokers [%v]. Error: %v", strings.Join(cfg.Brokers, ", "), err)
 	}
+	if o.healthRegistry != nil {
+		o.healthRegistry.Register(o.healthName, KafkaHealthCheck(client), o.healthOpts...)
+	}
 	return client, nil
 }
+
+// KafkaHealthCheck checks that at least one broker is connected or reachable, it's registered by NewKafkaClient with WithHealthCheck option
+func KafkaHealthCheck(client sarama.Client) health.Check {
+	return func(ctx context.Context) error {
+		if client.Closed() {
+			return errors.New("kafka client is closed")
+		}
+		for _, broker := range client.Brokers() {
+			if connected, _ := broker.Connected(); connected {
+				return nil
+			}
+		}
+		// sarama connects to brokers lazily and its calls don't accept context,
+		// so check that any broker is reachable with dial which stops on check timeout
+		var (
+			dialer net.Dialer
+			errs   []error
+		)
+		for _, broker := range client.Brokers() {
+			conn, err := dialer.DialContext(ctx, "tcp", broker.Addr())
+			if err == nil {
+				_ = conn.Close()
+				return nil
+			}
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if len(errs) == 0 {
+			return errors.New("no kafka brokers known")
+		}
+		return fmt.Errorf("no kafka brokers available: %w", errors.Join(errs...))
+	}
+}
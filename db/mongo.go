@@ -5,10 +5,11 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"github.com/einherij/enterprise/logging"
 )
 
 const (
@@ -17,20 +18,23 @@ const (
 
 type MongoDBConfig struct {
 	AppName   string `mapstructure:"app_name"`
-	Host      string `mapstructure:"host"`
-	Port      string `mapstructure:"port"`
+	Host      string `mapstructure:"host" validate:"required"`
+	Port      string `mapstructure:"port" default:"27017"`
 	Username  string `mapstructure:"username"`
 	Password  string `mapstructure:"password"`
 	AuthDB    string `mapstructure:"auth_db"`
-	UseDBName string `mapstructure:"database"`
+	UseDBName string `mapstructure:"database" validate:"required"`
 }
 
 type MongoClient struct {
 	Client   *mongo.Client
 	Database *mongo.Database
+
+	log logging.Logger
 }
 
-func NewMongoClient(cfg MongoDBConfig) (*MongoClient, error) {
+func NewMongoClient(cfg MongoDBConfig, opts ...Option) (*MongoClient, error) {
+	o := newOptions("mongodb", opts)
 	mongoDBAddress := fmt.Sprintf("mongodb://%s:%s/%s", cfg.Host, cfg.Port, cfg.UseDBName)
 	opt := options.Client()
 	opt.ApplyURI(mongoDBAddress)
@@ -53,10 +57,13 @@ func NewMongoClient(cfg MongoDBConfig) (*MongoClient, error) {
 	}
 
 	db := client.Database(cfg.UseDBName)
-	return &MongoClient{
+	mc := &MongoClient{
 		Client:   client,
 		Database: db,
-	}, nil
+		log:      o.log,
+	}
+	o.registerHealthCheck(mc.HealthCheck)
+	return mc, nil
 }
 
 // Disconnect from mongodb
@@ -67,8 +74,13 @@ func (c *MongoClient) Disconnect() {
 
 	err := c.Client.Disconnect(ctx)
 	if err != nil {
-		logrus.Errorf("[Disconnect] Error while try to close connection to mongodb: %v", err)
+		c.log.Errorf("[Disconnect] Error while try to close connection to mongodb: %v", err)
 		return
 	}
-	logrus.Info("[Disconnect] success disconnect mongodb")
+	c.log.Info("[Disconnect] success disconnect mongodb")
+}
+
+// HealthCheck pings the primary, it's registered by NewMongoClient with WithHealthCheck option
+func (c *MongoClient) HealthCheck(ctx context.Context) error {
+	return c.Client.Ping(ctx, readpref.Primary())
 }
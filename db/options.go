@@ -0,0 +1,59 @@
+package db
+
+import (
+	"github.com/einherij/enterprise/health"
+	"github.com/einherij/enterprise/logging"
+)
+
+// Option configures database client
+type Option func(o *clientOptions)
+
+type clientOptions struct {
+	component string
+	log       logging.Logger
+
+	healthRegistry *health.Registry
+	healthName     string
+	healthOpts     []health.Option
+}
+
+// WithLogger sets client logger, by default logger of the database component is used, e.g. "postgres"
+func WithLogger(logger logging.Logger) Option {
+	return func(o *clientOptions) {
+		o.log = logger
+	}
+}
+
+// WithHealthCheck registers health check of the client when it's created, health.DefaultRegistry is used
+// if registry is nil. Check is named after the database component if name is empty, e.g. "postgres",
+// options set its timeout and criticality.
+func WithHealthCheck(registry *health.Registry, name string, opts ...health.Option) Option {
+	return func(o *clientOptions) {
+		if registry == nil {
+			registry = health.DefaultRegistry
+		}
+		o.healthRegistry, o.healthName, o.healthOpts = registry, name, opts
+	}
+}
+
+func newOptions(component string, opts []Option) clientOptions {
+	o := clientOptions{
+		component: component,
+		log:       logging.Component(component),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o clientOptions) registerHealthCheck(check health.Check) {
+	if o.healthRegistry == nil {
+		return
+	}
+	name := o.healthName
+	if name == "" {
+		name = o.component
+	}
+	o.healthRegistry.Register(name, check, o.healthOpts...)
+}
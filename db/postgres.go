@@ -1,24 +1,27 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"time"
 
-	"github.com/sirupsen/logrus"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+
+	"github.com/einherij/enterprise/health"
 )
 
 type PostgresConfig struct {
-	Host     string `mapstructure:"host"`
-	Port     string `mapstructure:"port"`
-	Username string `mapstructure:"username"`
+	Host     string `mapstructure:"host" validate:"required"`
+	Port     string `mapstructure:"port" default:"5432"`
+	Username string `mapstructure:"username" validate:"required"`
 	Password string `mapstructure:"password"`
-	DBName   string `mapstructure:"database"`
+	DBName   string `mapstructure:"database" validate:"required"`
 }
 
-func NewPostgresClient(cfg PostgresConfig) (*gorm.DB, error) {
+func NewPostgresClient(cfg PostgresConfig, opts ...Option) (*gorm.DB, error) {
+	o := newOptions("postgres", opts)
 	dsn := fmt.Sprintf(
 		"postgresql://%s:%s@%s:%s/%s",
 		cfg.Username,
@@ -30,7 +33,7 @@ func NewPostgresClient(cfg PostgresConfig) (*gorm.DB, error) {
 	pgDB, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
 		SkipDefaultTransaction: true,
 		Logger: logger.New(
-			logrus.WithField("component", "gorm"),
+			o.log.WithField("component", "gorm"),
 			logger.Config{
 				SlowThreshold: time.Second,
 				Colorful:      false,
@@ -43,6 +46,18 @@ func NewPostgresClient(cfg PostgresConfig) (*gorm.DB, error) {
 			cfg.DBName, cfg.Host, cfg.Port, err,
 		)
 	}
-	logrus.Infof("connected to the database %q at %s:%s", cfg.DBName, cfg.Host, cfg.Port)
+	o.log.Infof("connected to the database %q at %s:%s", cfg.DBName, cfg.Host, cfg.Port)
+	o.registerHealthCheck(PostgresHealthCheck(pgDB))
 	return pgDB, nil
 }
+
+// PostgresHealthCheck pings the database, it's registered by NewPostgresClient with WithHealthCheck option
+func PostgresHealthCheck(pgDB *gorm.DB) health.Check {
+	return func(ctx context.Context) error {
+		sqlDB, err := pgDB.DB()
+		if err != nil {
+			return fmt.Errorf("error getting postgresql connection pool: %w", err)
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
@@ -1,21 +1,33 @@
 package db
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/go-redis/redis/v8"
+
+	"github.com/einherij/enterprise/health"
 )
 
 type RedisConfig struct {
-	Host string `mapstructure:"host"`
-	Port int    `mapstructure:"port"`
+	Host string `mapstructure:"host" validate:"required"`
+	Port int    `mapstructure:"port" default:"6379"`
 	DB   int    `mapstructure:"db"`
 }
 
-func NewRedisClient(cfg RedisConfig) (*redis.Client, error) {
+func NewRedisClient(cfg RedisConfig, opts ...Option) (*redis.Client, error) {
+	o := newOptions("redis", opts)
 	rdb := redis.NewClient(&redis.Options{
 		Addr: fmt.Sprintf("%v:%v", cfg.Host, cfg.Port),
 		DB:   cfg.DB,
 	})
+	o.registerHealthCheck(RedisHealthCheck(rdb))
 	return rdb, nil
 }
+
+// RedisHealthCheck pings the redis server, it's registered by NewRedisClient with WithHealthCheck option
+func RedisHealthCheck(rdb *redis.Client) health.Check {
+	return func(ctx context.Context) error {
+		return rdb.Ping(ctx).Err()
+	}
+}
@@ -0,0 +1,37 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/einherij/enterprise/logging"
+	"github.com/einherij/enterprise/utils"
+)
+
+var log = logging.Component("health")
+
+// LivenessHandler responds with liveness report, status code is 503 if any critical check fails
+func (r *Registry) LivenessHandler() http.Handler {
+	return reportHandler(r.Liveness)
+}
+
+// ReadinessHandler responds with readiness report, status code is 503 if any critical check fails
+func (r *Registry) ReadinessHandler() http.Handler {
+	return reportHandler(r.Readiness)
+}
+
+func reportHandler(getReport func(ctx context.Context) Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := getReport(req.Context())
+		utils.SetContentTypeHeader(w, utils.ContentTypeApplicationJSON)
+		if report.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.Warnf("error writing health report: %v", err)
+		}
+	})
+}
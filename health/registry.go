@@ -0,0 +1,219 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultCheckTimeout = 5 * time.Second
+
+var ErrShuttingDown = errors.New("application is shutting down")
+
+// Check returns error if the checked component is unhealthy
+type Check func(ctx context.Context) error
+
+// Checker is implemented by components which are able to check their health,
+// App registers checks of such runners automatically
+type Checker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+type namedCheck struct {
+	name     string
+	check    Check
+	timeout  time.Duration
+	critical bool
+	liveness bool
+}
+
+// Option configures a registered check
+type Option func(c *namedCheck)
+
+// Timeout limits the check execution time, the check fails when timeout is exceeded
+func Timeout(timeout time.Duration) Option {
+	return func(c *namedCheck) {
+		c.timeout = timeout
+	}
+}
+
+// NonCritical makes the check failure visible in report without failing the whole status
+func NonCritical() Option {
+	return func(c *namedCheck) {
+		c.critical = false
+	}
+}
+
+// Liveness makes the check part of liveness report besides readiness report.
+// Only checks which failure can be fixed by restart should be used for liveness.
+func Liveness() Option {
+	return func(c *namedCheck) {
+		c.liveness = true
+	}
+}
+
+// DefaultRegistry is used by App and liveness server if other registry isn't set
+var DefaultRegistry = NewRegistry()
+
+type Registry struct {
+	mux          sync.RWMutex
+	checks       []*namedCheck
+	shuttingDown atomic.Bool
+}
+
+func NewRegistry() *Registry {
+	return new(Registry)
+}
+
+// Register adds the check or replaces a check with the same name
+func (r *Registry) Register(name string, check Check, opts ...Option) {
+	c := &namedCheck{
+		name:     name,
+		check:    check,
+		timeout:  defaultCheckTimeout,
+		critical: true,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for i := range r.checks {
+		if r.checks[i].name == name {
+			r.checks[i] = c
+			return
+		}
+	}
+	r.checks = append(r.checks, c)
+}
+
+func (r *Registry) Unregister(name string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for i := range r.checks {
+		if r.checks[i].name == name {
+			r.checks = append(r.checks[:i], r.checks[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetShuttingDown makes readiness fail, so no new traffic is routed to the application
+func (r *Registry) SetShuttingDown() {
+	r.shuttingDown.Store(true)
+}
+
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusFailing Status = "failing"
+)
+
+type Report struct {
+	Status Status        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+type CheckResult struct {
+	Name     string `json:"name"`
+	Status   Status `json:"status"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Liveness runs only liveness checks
+func (r *Registry) Liveness(ctx context.Context) Report {
+	return r.run(ctx, true)
+}
+
+// Readiness runs all checks and fails when application is shutting down
+func (r *Registry) Readiness(ctx context.Context) Report {
+	report := r.run(ctx, false)
+	if r.shuttingDown.Load() {
+		report.Status = StatusFailing
+		report.Checks = append(report.Checks, CheckResult{
+			Name:     "shutdown",
+			Status:   StatusFailing,
+			Critical: true,
+			Error:    ErrShuttingDown.Error(),
+		})
+	}
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, livenessOnly bool) Report {
+	r.mux.RLock()
+	var checks = make([]*namedCheck, 0, len(r.checks))
+	for _, c := range r.checks {
+		if !livenessOnly || c.liveness {
+			checks = append(checks, c)
+		}
+	}
+	r.mux.RUnlock()
+
+	var (
+		wg     sync.WaitGroup
+		report = Report{
+			Status: StatusOK,
+			Checks: make([]CheckResult, len(checks)),
+		}
+	)
+	for i, c := range checks {
+		i, c := i, c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Critical && result.Status != StatusOK {
+			report.Status = StatusFailing
+		}
+	}
+	return report
+}
+
+func (c *namedCheck) run(ctx context.Context) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var (
+		started = time.Now()
+		result  = CheckResult{
+			Name:     c.name,
+			Status:   StatusOK,
+			Critical: c.critical,
+		}
+		errCh = make(chan error, 1)
+	)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- fmt.Errorf("check panic: %v", r)
+			}
+		}()
+		errCh <- c.check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = fmt.Errorf("check timeout: %w", ctx.Err())
+	}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+	result.Duration = time.Since(started).String()
+	return result
+}
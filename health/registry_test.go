@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RegistrySuite struct {
+	suite.Suite
+
+	registry *Registry
+}
+
+func TestRegistry(t *testing.T) {
+	suite.Run(t, new(RegistrySuite))
+}
+
+func (s *RegistrySuite) SetupTest() {
+	s.registry = NewRegistry()
+}
+
+func okCheck(context.Context) error {
+	return nil
+}
+
+func (s *RegistrySuite) TestReadiness() {
+	s.registry.Register("postgres", okCheck)
+	s.registry.Register("cache", func(context.Context) error {
+		return errors.New("cache is unavailable")
+	}, NonCritical())
+
+	report := s.registry.Readiness(context.Background())
+	s.Equal(StatusOK, report.Status)
+	s.Len(report.Checks, 2)
+	s.Equal("cache", report.Checks[1].Name)
+	s.Equal(StatusFailing, report.Checks[1].Status)
+	s.Equal("cache is unavailable", report.Checks[1].Error)
+
+	s.registry.Register("postgres", func(context.Context) error {
+		return errors.New("connection refused")
+	})
+	report = s.registry.Readiness(context.Background())
+	s.Equal(StatusFailing, report.Status)
+	s.Len(report.Checks, 2)
+
+	s.registry.Unregister("postgres")
+	report = s.registry.Readiness(context.Background())
+	s.Equal(StatusOK, report.Status)
+	s.Len(report.Checks, 1)
+}
+
+func (s *RegistrySuite) TestTimeout() {
+	var release = make(chan struct{})
+	defer close(release)
+	s.registry.Register("stuck", func(ctx context.Context) error {
+		<-release
+		return nil
+	}, Timeout(10*time.Millisecond))
+
+	report := s.registry.Readiness(context.Background())
+	s.Equal(StatusFailing, report.Status)
+	s.Contains(report.Checks[0].Error, "check timeout")
+}
+
+func (s *RegistrySuite) TestLiveness() {
+	s.registry.Register("deadlock_detector", okCheck, Liveness())
+	s.registry.Register("postgres", func(context.Context) error {
+		return errors.New("connection refused")
+	})
+
+	report := s.registry.Liveness(context.Background())
+	s.Equal(StatusOK, report.Status)
+	s.Len(report.Checks, 1)
+	s.Equal("deadlock_detector", report.Checks[0].Name)
+}
+
+func (s *RegistrySuite) TestShuttingDown() {
+	s.registry.Register("postgres", okCheck)
+	s.registry.SetShuttingDown()
+
+	s.Equal(StatusFailing, s.registry.Readiness(context.Background()).Status)
+	s.Equal(StatusOK, s.registry.Liveness(context.Background()).Status)
+}
+
+func (s *RegistrySuite) TestReadinessHandler() {
+	s.registry.Register("postgres", okCheck)
+
+	rec := httptest.NewRecorder()
+	s.registry.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal("application/json", rec.Header().Get("Content-Type"))
+	var report Report
+	s.NoError(json.NewDecoder(rec.Body).Decode(&report))
+	s.Equal(StatusOK, report.Status)
+
+	s.registry.SetShuttingDown()
+	rec = httptest.NewRecorder()
+	s.registry.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	s.Equal(http.StatusServiceUnavailable, rec.Code)
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Handler exposes levels of the manager:
+//
+//	GET    returns current levels
+//	PUT    ?level=debug sets the global level, ?level=debug&component=postgres sets the component level
+//	DELETE ?component=postgres resets the component level to the global one
+func (m *Manager) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			componentName = r.URL.Query().Get("component")
+			levelStr      = r.URL.Query().Get("level")
+		)
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			level, err := logrus.ParseLevel(levelStr)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if componentName != "" {
+				m.SetComponentLevel(componentName, level)
+			} else {
+				m.SetLevel(level)
+			}
+		case http.MethodDelete:
+			if componentName == "" {
+				http.Error(w, "component is required", http.StatusBadRequest)
+				return
+			}
+			m.ResetComponentLevel(componentName)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(m.Levels())
+	})
+}
@@ -0,0 +1,217 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Logger is the logging abstraction accepted by constructors of the project components
+type Logger = logrus.FieldLogger
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+
+	componentField = "component"
+)
+
+type Config struct {
+	Level  string `mapstructure:"level" default:"info"`
+	Format string `mapstructure:"format" default:"text" validate:"oneof=text json"`
+	// Components overrides level for specific components, e.g. {"postgres": "debug"}
+	Components map[string]string `mapstructure:"components"`
+}
+
+// Default manager controls logrus standard logger and loggers returned by Component
+var Default = NewManager(logrus.StandardLogger())
+
+// Component returns logger of the default manager
+func Component(name string) Logger {
+	return Default.Logger(name)
+}
+
+// Configure applies config to the default manager
+func Configure(cfg Config) error {
+	return Default.Configure(cfg)
+}
+
+// Manager creates component loggers sharing output and format of the root logger,
+// every component level can be changed at runtime independently of the global level
+type Manager struct {
+	mux        sync.RWMutex
+	root       *logrus.Logger
+	components map[string]*component
+}
+
+type component struct {
+	logger     *logrus.Logger
+	overridden bool
+}
+
+func NewManager(root *logrus.Logger) *Manager {
+	return &Manager{
+		root:       root,
+		components: make(map[string]*component),
+	}
+}
+
+// Logger returns logger with component field, the logger is created once for every component name
+func (m *Manager) Logger(name string) Logger {
+	m.mux.RLock()
+	c, ok := m.components[name]
+	m.mux.RUnlock()
+	if ok {
+		return c.logger.WithField(componentField, name)
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if c, ok = m.components[name]; !ok {
+		c = &component{logger: m.newLogger(m.root.GetLevel())}
+		m.components[name] = c
+	}
+	return c.logger.WithField(componentField, name)
+}
+
+// newLogger creates component logger which writes with the current output and formatter of the root logger,
+// hooks are copied, so they can be changed without affecting other loggers
+func (m *Manager) newLogger(level logrus.Level) *logrus.Logger {
+	hooks := make(logrus.LevelHooks, len(m.root.Hooks))
+	for hookLevel, levelHooks := range m.root.Hooks {
+		hooks[hookLevel] = append([]logrus.Hook(nil), levelHooks...)
+	}
+	return &logrus.Logger{
+		Out:          rootOutput{m},
+		Hooks:        hooks,
+		Formatter:    rootOutput{m},
+		ReportCaller: m.root.ReportCaller,
+		Level:        level,
+		ExitFunc:     m.root.ExitFunc,
+	}
+}
+
+// rootOutput formats and writes entries of component loggers by the root logger settings
+type rootOutput struct {
+	m *Manager
+}
+
+func (o rootOutput) Format(entry *logrus.Entry) ([]byte, error) {
+	o.m.mux.RLock()
+	formatter := o.m.root.Formatter
+	o.m.mux.RUnlock()
+	return formatter.Format(entry)
+}
+
+func (o rootOutput) Write(p []byte) (int, error) {
+	o.m.mux.RLock()
+	out := o.m.root.Out
+	o.m.mux.RUnlock()
+	return out.Write(p)
+}
+
+// SetOutput changes output of the root logger and all components
+func (m *Manager) SetOutput(out io.Writer) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.root.SetOutput(out)
+}
+
+// SetFormatter changes formatter of the root logger and all components
+func (m *Manager) SetFormatter(formatter logrus.Formatter) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.root.SetFormatter(formatter)
+}
+
+// Configure sets format, global level and component levels
+func (m *Manager) Configure(cfg Config) error {
+	var formatter logrus.Formatter
+	switch cfg.Format {
+	case "", FormatText:
+		formatter = new(logrus.TextFormatter)
+	case FormatJSON:
+		formatter = new(logrus.JSONFormatter)
+	default:
+		return fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+	m.SetFormatter(formatter)
+
+	if cfg.Level != "" {
+		level, err := logrus.ParseLevel(cfg.Level)
+		if err != nil {
+			return fmt.Errorf("error parsing log level: %w", err)
+		}
+		m.SetLevel(level)
+	}
+	for name, levelStr := range cfg.Components {
+		level, err := logrus.ParseLevel(levelStr)
+		if err != nil {
+			return fmt.Errorf("error parsing %s log level: %w", name, err)
+		}
+		m.SetComponentLevel(name, level)
+	}
+	return nil
+}
+
+// SetLevel changes level of root logger and components without overridden level
+func (m *Manager) SetLevel(level logrus.Level) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.root.SetLevel(level)
+	for _, c := range m.components {
+		if !c.overridden {
+			c.logger.SetLevel(level)
+		}
+	}
+}
+
+// SetComponentLevel overrides the global level for the component
+func (m *Manager) SetComponentLevel(name string, level logrus.Level) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	c, ok := m.components[name]
+	if !ok {
+		c = &component{logger: m.newLogger(level)}
+		m.components[name] = c
+	}
+	c.overridden = true
+	c.logger.SetLevel(level)
+}
+
+// ResetComponentLevel makes the component use the global level again
+func (m *Manager) ResetComponentLevel(name string) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if c, ok := m.components[name]; ok {
+		c.overridden = false
+		c.logger.SetLevel(m.root.GetLevel())
+	}
+}
+
+type Levels struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components,omitempty"`
+	Overridden []string          `json:"overridden,omitempty"`
+}
+
+// Levels returns the global level and current levels of all components
+func (m *Manager) Levels() Levels {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	levels := Levels{
+		Level:      m.root.GetLevel().String(),
+		Components: make(map[string]string),
+	}
+	for name, c := range m.components {
+		levels.Components[name] = c.logger.GetLevel().String()
+		if c.overridden {
+			levels.Overridden = append(levels.Overridden, name)
+		}
+	}
+	sort.Strings(levels.Overridden)
+	return levels
+}
@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+)
+
+type ManagerSuite struct {
+	suite.Suite
+
+	out     bytes.Buffer
+	manager *Manager
+}
+
+func TestManager(t *testing.T) {
+	suite.Run(t, new(ManagerSuite))
+}
+
+func (s *ManagerSuite) SetupTest() {
+	s.out.Reset()
+	root := logrus.New()
+	root.SetOutput(&s.out)
+	s.manager = NewManager(root)
+}
+
+func (s *ManagerSuite) TestComponentLevels() {
+	postgres := s.manager.Logger("postgres")
+	kafka := s.manager.Logger("kafka")
+
+	postgres.Debug("postgres debug")
+	s.Empty(s.out.String())
+
+	s.manager.SetComponentLevel("postgres", logrus.DebugLevel)
+	postgres.Debug("postgres debug")
+	kafka.Debug("kafka debug")
+	s.Contains(s.out.String(), "postgres debug")
+	s.Contains(s.out.String(), "component=postgres")
+	s.NotContains(s.out.String(), "kafka debug")
+
+	s.manager.SetLevel(logrus.ErrorLevel)
+	postgres.Debug("overridden level is kept")
+	kafka.Warn("kafka warning")
+	s.Contains(s.out.String(), "overridden level is kept")
+	s.NotContains(s.out.String(), "kafka warning")
+
+	s.manager.ResetComponentLevel("postgres")
+	postgres.Warn("postgres warning")
+	s.NotContains(s.out.String(), "postgres warning")
+}
+
+func (s *ManagerSuite) TestConfigure() {
+	s.NoError(s.manager.Configure(Config{
+		Level:      "warn",
+		Format:     FormatJSON,
+		Components: map[string]string{"postgres": "debug"},
+	}))
+	s.manager.Logger("postgres").Debug("postgres debug")
+
+	var entry map[string]any
+	s.NoError(json.Unmarshal(s.out.Bytes(), &entry))
+	s.Equal("postgres debug", entry["msg"])
+	s.Equal("postgres", entry["component"])
+	s.Equal(Levels{
+		Level:      "warning",
+		Components: map[string]string{"postgres": "debug"},
+		Overridden: []string{"postgres"},
+	}, s.manager.Levels())
+
+	s.Error(s.manager.Configure(Config{Format: "xml"}))
+	s.Error(s.manager.Configure(Config{Level: "loud"}))
+}
+
+func (s *ManagerSuite) TestRootOutputChanges() {
+	postgres := s.manager.Logger("postgres")
+
+	var out bytes.Buffer
+	s.manager.SetOutput(&out)
+	s.manager.SetFormatter(new(logrus.JSONFormatter))
+	postgres.Warn("postgres warning")
+	s.Empty(s.out.String())
+	var entry map[string]any
+	s.NoError(json.Unmarshal(out.Bytes(), &entry))
+	s.Equal("postgres warning", entry["msg"])
+	s.Equal("postgres", entry["component"])
+}
+
+func (s *ManagerSuite) TestHandler() {
+	s.manager.Logger("postgres")
+	handler := s.manager.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/loglevel?level=debug&component=postgres", nil))
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(logrus.DebugLevel.String(), s.manager.Levels().Components["postgres"])
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/loglevel?level=error", nil))
+	s.Equal(http.StatusOK, rec.Code)
+	var levels Levels
+	s.NoError(json.NewDecoder(rec.Body).Decode(&levels))
+	s.Equal("error", levels.Level)
+	s.Equal("debug", levels.Components["postgres"])
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/loglevel?component=postgres", nil))
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal("error", s.manager.Levels().Components["postgres"])
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/loglevel?level=loud", nil))
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
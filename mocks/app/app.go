@@ -34,6 +34,23 @@ func (m *MockApplication) EXPECT() *MockApplicationMockRecorder {
 	return m.recorder
 }
 
+// RegisterNamedRunner mocks base method.
+func (m *MockApplication) RegisterNamedRunner(name string, runner enterprise.Runner, opts ...enterprise.RunnerOption) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{name, runner}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "RegisterNamedRunner", varargs...)
+}
+
+// RegisterNamedRunner indicates an expected call of RegisterNamedRunner.
+func (mr *MockApplicationMockRecorder) RegisterNamedRunner(name, runner interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{name, runner}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterNamedRunner", reflect.TypeOf((*MockApplication)(nil).RegisterNamedRunner), varargs...)
+}
+
 // RegisterOnRun mocks base method.
 func (m *MockApplication) RegisterOnRun(f func()) {
 	m.ctrl.T.Helper()
@@ -71,9 +88,11 @@ func (mr *MockApplicationMockRecorder) RegisterRunner(runner interface{}) *gomoc
 }
 
 // Run mocks base method.
-func (m *MockApplication) Run() {
+func (m *MockApplication) Run() error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Run")
+	ret := m.ctrl.Call(m, "Run")
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // Run indicates an expected call of Run.
@@ -45,3 +45,40 @@ func (mr *MockRunnerMockRecorder) Run(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Run", reflect.TypeOf((*MockRunner)(nil).Run), ctx)
 }
+
+// MockRunnerE is a mock of RunnerE interface.
+type MockRunnerE struct {
+	ctrl     *gomock.Controller
+	recorder *MockRunnerEMockRecorder
+}
+
+// MockRunnerEMockRecorder is the mock recorder for MockRunnerE.
+type MockRunnerEMockRecorder struct {
+	mock *MockRunnerE
+}
+
+// NewMockRunnerE creates a new mock instance.
+func NewMockRunnerE(ctrl *gomock.Controller) *MockRunnerE {
+	mock := &MockRunnerE{ctrl: ctrl}
+	mock.recorder = &MockRunnerEMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRunnerE) EXPECT() *MockRunnerEMockRecorder {
+	return m.recorder
+}
+
+// RunE mocks base method.
+func (m *MockRunnerE) RunE(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RunE", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RunE indicates an expected call of RunE.
+func (mr *MockRunnerEMockRecorder) RunE(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunE", reflect.TypeOf((*MockRunnerE)(nil).RunE), ctx)
+}
@@ -0,0 +1,112 @@
+package raft
+
+import (
+	"context"
+
+	"github.com/einherij/enterprise"
+	"github.com/einherij/enterprise/logging"
+)
+
+type leaderRunner struct {
+	log     logging.Logger
+	replica LeadershipObserver
+	runner  enterprise.Runner
+}
+
+var _ enterprise.RunnerE = (*leaderRunner)(nil)
+
+// NewLeaderRunner returns runner which runs the given runner only while the replica is the leader,
+// so it's a singleton in the cluster. Context of the runner is cancelled when leadership is lost,
+// the runner is started again when leadership is regained. Failure of RunnerE while the replica is the leader
+// stops the leader runner and is returned by its RunE.
+//
+// The old leader learns that it lost leadership only after election timeout without responses from majority,
+// so its runner may still run for a while after the runner of the new leader is started.
+// Side effects which must not be done twice should be fenced, e.g. executed as replicated commands,
+// which old leader can't commit, or guarded by IsLeader check right before them.
+func NewLeaderRunner(name string, replica LeadershipObserver, runner enterprise.Runner) enterprise.Runner {
+	return &leaderRunner{
+		log:     logging.Component(name),
+		replica: replica,
+		runner:  runner,
+	}
+}
+
+func (lr *leaderRunner) Run(ctx context.Context) {
+	if err := lr.RunE(ctx); err != nil {
+		lr.log.Errorf("leader runner failed: %v", err)
+	}
+}
+
+// RunE returns error of the runner which failed while the replica is the leader,
+// errors returned after leadership is lost are only logged
+func (lr *leaderRunner) RunE(ctx context.Context) error {
+	// subscribe before checking leadership, so no change is missed
+	changes, unsubscribe := lr.replica.LeadershipChanges()
+	defer unsubscribe()
+
+	var (
+		cancel context.CancelFunc
+		done   chan struct{}
+		failed = make(chan error, 1)
+	)
+	start := func() {
+		if cancel != nil {
+			return
+		}
+		lr.log.Info("replica became the leader, starting runner")
+		var runCtx context.Context
+		runCtx, cancel = context.WithCancel(ctx)
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			err := lr.run(runCtx)
+			switch {
+			case err == nil:
+			case runCtx.Err() != nil:
+				lr.log.Warnf("runner failed after leadership is lost: %v", err)
+			default:
+				select {
+				case failed <- err:
+				default:
+				}
+			}
+		}()
+	}
+	stop := func() {
+		if cancel == nil {
+			return
+		}
+		cancel()
+		<-done
+		cancel = nil
+	}
+	defer stop()
+
+	if lr.replica.IsLeader() {
+		start()
+	}
+	for {
+		select {
+		case change := <-changes:
+			if change.IsLeader {
+				start()
+			} else if cancel != nil {
+				lr.log.Infof("replica lost leadership, leader is %q, stopping runner", change.Leader)
+				stop()
+			}
+		case err := <-failed:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (lr *leaderRunner) run(ctx context.Context) error {
+	if runnerE, ok := lr.runner.(enterprise.RunnerE); ok {
+		return runnerE.RunE(ctx)
+	}
+	lr.runner.Run(ctx)
+	return nil
+}
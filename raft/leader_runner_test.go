@@ -0,0 +1,114 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/einherij/enterprise"
+	"github.com/einherij/enterprise/raft/raftgrpc"
+)
+
+type LeaderRunnerSuite struct {
+	suite.Suite
+}
+
+func TestLeaderRunner(t *testing.T) {
+	suite.Run(t, new(LeaderRunnerSuite))
+}
+
+type fakeObserver struct {
+	isLeader atomic.Bool
+	changes  chan raftgrpc.Leadership
+}
+
+func (fo *fakeObserver) IsLeader() bool {
+	return fo.isLeader.Load()
+}
+
+func (fo *fakeObserver) LeadershipChanges() (<-chan raftgrpc.Leadership, func()) {
+	return fo.changes, func() {}
+}
+
+func (s *LeaderRunnerSuite) TestRunWhileLeader() {
+	var (
+		observer = &fakeObserver{changes: make(chan raftgrpc.Leadership)}
+		started  = make(chan struct{}, 1)
+		stopped  = make(chan struct{}, 1)
+		runner   = enterprise.NewRunner("job", func(ctx context.Context) {
+			started <- struct{}{}
+			<-ctx.Done()
+			stopped <- struct{}{}
+		})
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan struct{})
+	)
+	observer.isLeader.Store(true)
+	go func() {
+		defer close(done)
+		NewLeaderRunner("leader_job", observer, runner).Run(ctx)
+	}()
+	s.receive(started)
+
+	observer.changes <- raftgrpc.Leadership{Leader: "b", Term: 2}
+	s.receive(stopped)
+	observer.changes <- raftgrpc.Leadership{Term: 3}
+
+	observer.changes <- raftgrpc.Leadership{Leader: "a", Term: 4, IsLeader: true}
+	s.receive(started)
+	// re-election doesn't restart runner
+	observer.changes <- raftgrpc.Leadership{Leader: "a", Term: 5, IsLeader: true}
+	s.Empty(started)
+
+	cancel()
+	s.receive(stopped)
+	s.receive(done)
+}
+
+func (s *LeaderRunnerSuite) TestRunnerError() {
+	var (
+		observer  = &fakeObserver{changes: make(chan raftgrpc.Leadership)}
+		errFailed = errors.New("failed")
+		started   = make(chan struct{}, 1)
+		runs      atomic.Int32
+		runner    = enterprise.NewRunnerE("job", func(ctx context.Context) error {
+			started <- struct{}{}
+			if runs.Add(1) == 1 {
+				<-ctx.Done()
+			}
+			return errFailed
+		})
+		result = make(chan error, 1)
+	)
+	observer.isLeader.Store(true)
+	go func() {
+		result <- NewLeaderRunner("leader_job", observer, runner).(enterprise.RunnerE).RunE(context.Background())
+	}()
+	s.receive(started)
+
+	// error after leadership is lost is only logged
+	observer.changes <- raftgrpc.Leadership{Leader: "b", Term: 2}
+	s.Empty(result)
+
+	// failure under leadership is returned
+	observer.changes <- raftgrpc.Leadership{Leader: "a", Term: 3, IsLeader: true}
+	s.receive(started)
+	select {
+	case err := <-result:
+		s.ErrorIs(err, errFailed)
+	case <-time.After(time.Second):
+		s.Fail("timeout")
+	}
+}
+
+func (s *LeaderRunnerSuite) receive(ch <-chan struct{}) {
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		s.Fail("timeout")
+	}
+}
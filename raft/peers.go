@@ -0,0 +1,80 @@
+package raft
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/einherij/enterprise/raft/raftgrpc/protocol"
+)
+
+// peers keeps one grpc connection per replica, connection is re-established in background after failures
+// and requests to unavailable replica fail at once
+type peers struct {
+	reconnectFrom time.Duration
+	reconnectTo   time.Duration
+
+	mux   sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+func newPeers(reconnectFrom, reconnectTo time.Duration) *peers {
+	return &peers{
+		reconnectFrom: reconnectFrom,
+		reconnectTo:   reconnectTo,
+		conns:         make(map[string]*grpc.ClientConn),
+	}
+}
+
+func (p *peers) client(address string) (protocol.FollowerClient, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	conn, ok := p.conns[address]
+	if !ok {
+		var err error
+		if conn, err = p.dial(address); err != nil {
+			return nil, err
+		}
+		p.conns[address] = conn
+	}
+	return protocol.NewFollowerClient(conn), nil
+}
+
+func (p *peers) dial(address string) (*grpc.ClientConn, error) {
+	const externalServer = false
+	// use tls credentials for external grpc server
+	var transportCreds credentials.TransportCredentials
+	if externalServer {
+		transportCreds = credentials.NewTLS(&tls.Config{})
+	} else {
+		transportCreds = insecure.NewCredentials()
+	}
+
+	reconnect := backoff.DefaultConfig
+	reconnect.BaseDelay = p.reconnectFrom
+	reconnect.MaxDelay = p.reconnectTo
+	conn, err := grpc.Dial(address,
+		grpc.WithTransportCredentials(transportCreds),
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: reconnect, MinConnectTimeout: grpcConnectTimeout}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to replica at %q: %w", address, err)
+	}
+	return conn, nil
+}
+
+// close closes connections, they are opened again on the next request
+func (p *peers) close() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for address, conn := range p.conns {
+		_ = conn.Close()
+		delete(p.conns, address)
+	}
+}
@@ -0,0 +1,67 @@
+package raftgrpc
+
+// Leadership describes the leader known by the replica, Leader is empty while elections are in progress
+type Leadership struct {
+	Leader   string
+	Term     uint64
+	IsLeader bool
+}
+
+// Leader returns address of the current leader or empty string if it's unknown
+func (rs *ReplicaServer) Leader() string {
+	rs.logMux.Lock()
+	defer rs.logMux.Unlock()
+	return rs.leader
+}
+
+// ForgetLeader is called by follower which doesn't receive append entries until election timeout
+func (rs *ReplicaServer) ForgetLeader() {
+	rs.logMux.Lock()
+	defer rs.logMux.Unlock()
+	rs.setLeaderLocked("")
+}
+
+// LeadershipChanges subscribes to changes of the leader, the channel keeps only the latest change,
+// so slow subscribers don't block the replica. Returned function cancels subscription.
+func (rs *ReplicaServer) LeadershipChanges() (<-chan Leadership, func()) {
+	rs.logMux.Lock()
+	defer rs.logMux.Unlock()
+	var (
+		id      = rs.nextSubscriberID
+		changes = make(chan Leadership, 1)
+	)
+	rs.nextSubscriberID++
+	rs.subscribers[id] = changes
+	return changes, func() {
+		rs.logMux.Lock()
+		defer rs.logMux.Unlock()
+		delete(rs.subscribers, id)
+	}
+}
+
+// setLeaderLocked notifies subscribers if the leader is changed or re-elected in a new term
+func (rs *ReplicaServer) setLeaderLocked(leader string) {
+	term := rs.term.Load()
+	if leader == rs.leader && (leader == "" || term == rs.leaderTerm) {
+		return
+	}
+	rs.leader, rs.leaderTerm = leader, term
+
+	change := Leadership{
+		Leader:   leader,
+		Term:     term,
+		IsLeader: leader != "" && leader == rs.storage.GetMyAddress(),
+	}
+	for _, changes := range rs.subscribers {
+		select {
+		case changes <- change:
+		default:
+			// replace the change which isn't received yet
+			select {
+			case <-changes:
+			default:
+			}
+			changes <- change
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package raftgrpc
+
+import (
+	"github.com/einherij/enterprise/raft/raftgrpc/protocol"
+)
+
+// raftLog keeps replicated entries, the first entry has index 1
+type raftLog struct {
+	entries []*protocol.LogEntry
+}
+
+func (l *raftLog) lastIndex() uint64 {
+	return uint64(len(l.entries))
+}
+
+func (l *raftLog) lastTerm() uint64 {
+	if len(l.entries) == 0 {
+		return 0
+	}
+	return l.entries[len(l.entries)-1].GetTerm()
+}
+
+// term returns term of the entry at index, zero index has zero term
+func (l *raftLog) term(index uint64) (term uint64, ok bool) {
+	if index == 0 {
+		return 0, true
+	}
+	if index > l.lastIndex() {
+		return 0, false
+	}
+	return l.entries[index-1].GetTerm(), true
+}
+
+// slice returns a copy of at most max entries in [from, to]
+func (l *raftLog) slice(from, to uint64, max int) []*protocol.LogEntry {
+	if from == 0 {
+		from = 1
+	}
+	if to > l.lastIndex() {
+		to = l.lastIndex()
+	}
+	if from > to {
+		return nil
+	}
+	if to-from+1 > uint64(max) {
+		to = from + uint64(max) - 1
+	}
+	return append([]*protocol.LogEntry(nil), l.entries[from-1:to]...)
+}
+
+func (l *raftLog) append(entries ...*protocol.LogEntry) {
+	l.entries = append(l.entries, entries...)
+}
+
+// truncate removes entries starting from index
+func (l *raftLog) truncate(from uint64) {
+	if from == 0 || from > l.lastIndex() {
+		return
+	}
+	l.entries = l.entries[:from-1]
+}
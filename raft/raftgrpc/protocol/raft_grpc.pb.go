@@ -18,9 +18,10 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type FollowerClient interface {
-	SendExecuteCommand(ctx context.Context, in *Command, opts ...grpc.CallOption) (*Nothing, error)
-	SendHeartBeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
+	AppendEntries(ctx context.Context, in *AppendEntriesRequest, opts ...grpc.CallOption) (*AppendEntriesResponse, error)
 	SendElectionRequest(ctx context.Context, in *ElectionRequest, opts ...grpc.CallOption) (*ElectionResponse, error)
+	// ExecuteCommand is sent by followers to the leader to execute command through the replicated log
+	ExecuteCommand(ctx context.Context, in *ExecuteCommandRequest, opts ...grpc.CallOption) (*ExecuteCommandResponse, error)
 }
 
 type followerClient struct {
@@ -31,27 +32,27 @@ func NewFollowerClient(cc grpc.ClientConnInterface) FollowerClient {
 	return &followerClient{cc}
 }
 
-func (c *followerClient) SendExecuteCommand(ctx context.Context, in *Command, opts ...grpc.CallOption) (*Nothing, error) {
-	out := new(Nothing)
-	err := c.cc.Invoke(ctx, "/protocol.Follower/SendExecuteCommand", in, out, opts...)
+func (c *followerClient) AppendEntries(ctx context.Context, in *AppendEntriesRequest, opts ...grpc.CallOption) (*AppendEntriesResponse, error) {
+	out := new(AppendEntriesResponse)
+	err := c.cc.Invoke(ctx, "/protocol.Follower/AppendEntries", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *followerClient) SendHeartBeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
-	out := new(HeartbeatResponse)
-	err := c.cc.Invoke(ctx, "/protocol.Follower/SendHeartBeat", in, out, opts...)
+func (c *followerClient) SendElectionRequest(ctx context.Context, in *ElectionRequest, opts ...grpc.CallOption) (*ElectionResponse, error) {
+	out := new(ElectionResponse)
+	err := c.cc.Invoke(ctx, "/protocol.Follower/SendElectionRequest", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *followerClient) SendElectionRequest(ctx context.Context, in *ElectionRequest, opts ...grpc.CallOption) (*ElectionResponse, error) {
-	out := new(ElectionResponse)
-	err := c.cc.Invoke(ctx, "/protocol.Follower/SendElectionRequest", in, out, opts...)
+func (c *followerClient) ExecuteCommand(ctx context.Context, in *ExecuteCommandRequest, opts ...grpc.CallOption) (*ExecuteCommandResponse, error) {
+	out := new(ExecuteCommandResponse)
+	err := c.cc.Invoke(ctx, "/protocol.Follower/ExecuteCommand", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -62,9 +63,10 @@ func (c *followerClient) SendElectionRequest(ctx context.Context, in *ElectionRe
 // All implementations must embed UnimplementedFollowerServer
 // for forward compatibility
 type FollowerServer interface {
-	SendExecuteCommand(context.Context, *Command) (*Nothing, error)
-	SendHeartBeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
+	AppendEntries(context.Context, *AppendEntriesRequest) (*AppendEntriesResponse, error)
 	SendElectionRequest(context.Context, *ElectionRequest) (*ElectionResponse, error)
+	// ExecuteCommand is sent by followers to the leader to execute command through the replicated log
+	ExecuteCommand(context.Context, *ExecuteCommandRequest) (*ExecuteCommandResponse, error)
 	mustEmbedUnimplementedFollowerServer()
 }
 
@@ -72,15 +74,15 @@ type FollowerServer interface {
 type UnimplementedFollowerServer struct {
 }
 
-func (UnimplementedFollowerServer) SendExecuteCommand(context.Context, *Command) (*Nothing, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method SendExecuteCommand not implemented")
-}
-func (UnimplementedFollowerServer) SendHeartBeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method SendHeartBeat not implemented")
+func (UnimplementedFollowerServer) AppendEntries(context.Context, *AppendEntriesRequest) (*AppendEntriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AppendEntries not implemented")
 }
 func (UnimplementedFollowerServer) SendElectionRequest(context.Context, *ElectionRequest) (*ElectionResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendElectionRequest not implemented")
 }
+func (UnimplementedFollowerServer) ExecuteCommand(context.Context, *ExecuteCommandRequest) (*ExecuteCommandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExecuteCommand not implemented")
+}
 func (UnimplementedFollowerServer) mustEmbedUnimplementedFollowerServer() {}
 
 // UnsafeFollowerServer may be embedded to opt out of forward compatibility for this service.
@@ -94,56 +96,56 @@ func RegisterFollowerServer(s grpc.ServiceRegistrar, srv FollowerServer) {
 	s.RegisterService(&Follower_ServiceDesc, srv)
 }
 
-func _Follower_SendExecuteCommand_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Command)
+func _Follower_AppendEntries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AppendEntriesRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(FollowerServer).SendExecuteCommand(ctx, in)
+		return srv.(FollowerServer).AppendEntries(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/protocol.Follower/SendExecuteCommand",
+		FullMethod: "/protocol.Follower/AppendEntries",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(FollowerServer).SendExecuteCommand(ctx, req.(*Command))
+		return srv.(FollowerServer).AppendEntries(ctx, req.(*AppendEntriesRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Follower_SendHeartBeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(HeartbeatRequest)
+func _Follower_SendElectionRequest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ElectionRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(FollowerServer).SendHeartBeat(ctx, in)
+		return srv.(FollowerServer).SendElectionRequest(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/protocol.Follower/SendHeartBeat",
+		FullMethod: "/protocol.Follower/SendElectionRequest",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(FollowerServer).SendHeartBeat(ctx, req.(*HeartbeatRequest))
+		return srv.(FollowerServer).SendElectionRequest(ctx, req.(*ElectionRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Follower_SendElectionRequest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(ElectionRequest)
+func _Follower_ExecuteCommand_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExecuteCommandRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(FollowerServer).SendElectionRequest(ctx, in)
+		return srv.(FollowerServer).ExecuteCommand(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/protocol.Follower/SendElectionRequest",
+		FullMethod: "/protocol.Follower/ExecuteCommand",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(FollowerServer).SendElectionRequest(ctx, req.(*ElectionRequest))
+		return srv.(FollowerServer).ExecuteCommand(ctx, req.(*ExecuteCommandRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -156,17 +158,17 @@ var Follower_ServiceDesc = grpc.ServiceDesc{
 	HandlerType: (*FollowerServer)(nil),
 	Methods: []grpc.MethodDesc{
 		{
-			MethodName: "SendExecuteCommand",
-			Handler:    _Follower_SendExecuteCommand_Handler,
-		},
-		{
-			MethodName: "SendHeartBeat",
-			Handler:    _Follower_SendHeartBeat_Handler,
+			MethodName: "AppendEntries",
+			Handler:    _Follower_AppendEntries_Handler,
 		},
 		{
 			MethodName: "SendElectionRequest",
 			Handler:    _Follower_SendElectionRequest_Handler,
 		},
+		{
+			MethodName: "ExecuteCommand",
+			Handler:    _Follower_ExecuteCommand_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "raft.proto",
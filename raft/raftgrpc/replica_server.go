@@ -4,16 +4,30 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/einherij/enterprise/logging"
 	"github.com/einherij/enterprise/raft/raftgrpc/protocol"
 	"github.com/einherij/enterprise/raft/raftstorage"
+	"github.com/einherij/enterprise/raft/raftstore"
 )
 
 const (
 	waitFollowerStateTimeout = 20 * time.Millisecond
+	// appliedRequestsWindow is number of the latest request ids remembered to skip repeated entries
+	appliedRequestsWindow = 10000
+)
+
+var (
+	ErrUnknownCommand   = errors.New("unknown command")
+	ErrEntryOverwritten = errors.New("log entry is overwritten by another leader")
+	ErrNotLeader        = errors.New("replica is not the leader")
 )
 
 type State uint
@@ -38,26 +52,89 @@ func (s State) String() string {
 
 type ReplicaServer struct {
 	storage raftstorage.Storage
+	store   raftstore.Store
+	logger  logging.Logger
 
 	commandsMux sync.RWMutex
 	commands    map[string]Command
 	state       atomic.Uint32
-	term        atomic.Uint64
+	// term is changed under logMux after it's persisted, but can be read without lock
+	term atomic.Uint64
+
+	logMux        sync.Mutex
+	votedFor      string
+	leader        string
+	leaderTerm    uint64
+	leaderContact time.Time
+	leaderLease   time.Duration
+	log           raftLog
+	commitIndex   uint64
+	lastApplied   uint64
+	// results of entries proposed by this replica, delivered on apply
+	results   map[uint64]chan error
+	commits   chan struct{}
+	proposals chan struct{}
+	// results of the latest applied requests, used only by the applier
+	appliedRequests map[string]error
+	appliedOrder    []string
+
+	subscribers      map[int]chan Leadership
+	nextSubscriberID int
 
 	heartbeats       chan string
 	electionRequests chan string
 	protocol.UnimplementedFollowerServer
 }
 
+// Command is applied on every replica in log order, it's applied again for every committed entry after restart,
+// so it must be idempotent or rebuild the state it owns
 type Command func(ctx context.Context, myAddress string, myState State, replicaCount int, sharedData []byte) error
 
-func NewReplicaServer(storage raftstorage.Storage) *ReplicaServer {
-	return &ReplicaServer{
+// ServerOption configures ReplicaServer
+type ServerOption func(rs *ReplicaServer)
+
+// WithStore sets store of term, vote and log entries, by default state is kept in memory
+func WithStore(store raftstore.Store) ServerOption {
+	return func(rs *ReplicaServer) {
+		rs.store = store
+	}
+}
+
+// WithLogger sets server logger, by default logger of "raft_server" component is used
+func WithLogger(logger logging.Logger) ServerOption {
+	return func(rs *ReplicaServer) {
+		rs.logger = logger
+	}
+}
+
+// NewReplicaServer restores term, vote and log entries from the store.
+// Applied index isn't persisted: the whole log is applied again from the first entry when the leader confirms commit index.
+// Applied requests are remembered while log is applied, so repeated requests are skipped the same way as before restart.
+func NewReplicaServer(storage raftstorage.Storage, opts ...ServerOption) (*ReplicaServer, error) {
+	rs := &ReplicaServer{
 		storage:          storage,
+		store:            raftstore.NewMemoryStore(),
+		logger:           logging.Component("raft_server"),
 		commands:         make(map[string]Command),
+		results:          make(map[uint64]chan error),
+		appliedRequests:  make(map[string]error),
+		commits:          make(chan struct{}, 1),
+		proposals:        make(chan struct{}, 1),
+		subscribers:      make(map[int]chan Leadership),
 		heartbeats:       make(chan string),
 		electionRequests: make(chan string),
 	}
+	for _, opt := range opts {
+		opt(rs)
+	}
+	state, entries, err := rs.store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("error loading raft state: %w", err)
+	}
+	rs.term.Store(state.Term)
+	rs.votedFor = state.VotedFor
+	rs.log.append(entries...)
+	return rs, nil
 }
 
 func (rs *ReplicaServer) AddCommand(commandName string, command Command) {
@@ -66,63 +143,416 @@ func (rs *ReplicaServer) AddCommand(commandName string, command Command) {
 	rs.commands[commandName] = command
 }
 
-func (rs *ReplicaServer) SendExecuteCommand(ctx context.Context, command *protocol.Command) (*protocol.Nothing, error) {
+// Run applies committed entries to registered commands in log order
+func (rs *ReplicaServer) Run(ctx context.Context) {
+	for {
+		select {
+		case <-rs.commits:
+			rs.applyCommitted(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (rs *ReplicaServer) applyCommitted(ctx context.Context) {
+	rs.logMux.Lock()
+	entries := rs.log.slice(rs.lastApplied+1, rs.commitIndex, math.MaxInt)
+	rs.logMux.Unlock()
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		applied, err := rs.appliedRequest(entry.GetRequestId())
+		if applied {
+			rs.logger.Debugf("entry %d repeats applied request %s, skipping", entry.GetIndex(), entry.GetRequestId())
+		} else {
+			err = rs.apply(ctx, entry)
+			if err != nil {
+				rs.logger.Errorf("error applying entry %d of command %q: %v", entry.GetIndex(), entry.GetCommandName(), err)
+			}
+			rs.rememberRequest(entry.GetRequestId(), err)
+		}
+
+		rs.logMux.Lock()
+		rs.lastApplied = entry.GetIndex()
+		if result, ok := rs.results[entry.GetIndex()]; ok {
+			result <- err
+			delete(rs.results, entry.GetIndex())
+		}
+		rs.logMux.Unlock()
+	}
+}
+
+// appliedRequest returns result of the request if it's already applied.
+// Every replica applies the same log, so all of them skip the same entries.
+func (rs *ReplicaServer) appliedRequest(requestID string) (applied bool, err error) {
+	if requestID == "" {
+		return false, nil
+	}
+	err, applied = rs.appliedRequests[requestID]
+	return applied, err
+}
+
+func (rs *ReplicaServer) rememberRequest(requestID string, err error) {
+	if requestID == "" {
+		return
+	}
+	if len(rs.appliedOrder) >= appliedRequestsWindow {
+		delete(rs.appliedRequests, rs.appliedOrder[0])
+		rs.appliedOrder = rs.appliedOrder[1:]
+	}
+	rs.appliedRequests[requestID] = err
+	rs.appliedOrder = append(rs.appliedOrder, requestID)
+}
+
+func (rs *ReplicaServer) apply(ctx context.Context, entry *protocol.LogEntry) error {
+	if entry.GetCommandName() == "" {
+		return nil // no-op entry of a new leader
+	}
+	rs.commandsMux.RLock()
+	command, ok := rs.commands[entry.GetCommandName()]
+	rs.commandsMux.RUnlock()
+	if !ok {
+		return ErrUnknownCommand
+	}
 	replicas, err := rs.storage.GetReplicas()
 	if err != nil {
-		return nil, fmt.Errorf("error getting replicas: %w", err)
+		return fmt.Errorf("error getting replicas: %w", err)
 	}
-	rs.commandsMux.RLock()
-	defer rs.commandsMux.RUnlock()
-	err = rs.commands[command.GetName()](ctx, rs.storage.GetMyAddress(), State(rs.state.Load()), len(replicas), command.GetSharedData())
+	return command(ctx, rs.storage.GetMyAddress(), rs.GetState(), len(replicas), entry.GetSharedData())
+}
+
+// Propose appends command to the log in the current term,
+// returned channel receives result of the command when entry is applied on this replica.
+// Entries with the same non-empty requestID are applied once, so retried commands aren't repeated.
+func (rs *ReplicaServer) Propose(requestID, commandName string, sharedData []byte) (index uint64, result <-chan error, err error) {
+	rs.logMux.Lock()
+	defer rs.logMux.Unlock()
+	if rs.GetState() != Leader {
+		return 0, nil, ErrNotLeader
+	}
+	entry := &protocol.LogEntry{
+		Index:       rs.log.lastIndex() + 1,
+		Term:        rs.term.Load(),
+		CommandName: commandName,
+		SharedData:  sharedData,
+		RequestId:   requestID,
+	}
+	if err = rs.store.Append(entry); err != nil {
+		return 0, nil, fmt.Errorf("error persisting entry: %w", err)
+	}
+	rs.log.append(entry)
+	done := make(chan error, 1)
+	rs.results[entry.GetIndex()] = done
+	select {
+	case rs.proposals <- struct{}{}:
+	default:
+	}
+	return entry.GetIndex(), done, nil
+}
+
+// Execute proposes command on the leader and waits until it's committed and applied on this replica
+func (rs *ReplicaServer) Execute(ctx context.Context, requestID, commandName string, sharedData []byte) error {
+	index, result, err := rs.Propose(requestID, commandName, sharedData)
 	if err != nil {
-		return nil, fmt.Errorf("error executing command: %w", err)
+		return err
+	}
+	select {
+	case err = <-result:
+		if err != nil {
+			return fmt.Errorf("error executing command %s: %w", commandName, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("command %s with log index %d isn't applied: %w", commandName, index, ctx.Err())
 	}
-	return &protocol.Nothing{}, nil
 }
 
-func (rs *ReplicaServer) SendHeartBeat(ctx context.Context, heartbeatRequest *protocol.HeartbeatRequest) (*protocol.HeartbeatResponse, error) {
+// ExecuteCommand executes command forwarded by follower, leader known by this replica is returned
+// if it isn't the leader or the entry is overwritten by another leader, so the follower retries the command
+func (rs *ReplicaServer) ExecuteCommand(ctx context.Context, request *protocol.ExecuteCommandRequest) (*protocol.ExecuteCommandResponse, error) {
+	err := rs.Execute(ctx, request.GetRequestId(), request.GetCommandName(), request.GetSharedData())
+	switch {
+	case errors.Is(err, ErrNotLeader), errors.Is(err, ErrEntryOverwritten):
+		return &protocol.ExecuteCommandResponse{NotLeader: true, LeaderAddress: rs.Leader()}, nil
+	case errors.Is(err, ErrUnknownCommand):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		return nil, err
+	}
+	return &protocol.ExecuteCommandResponse{}, nil
+}
 
-	if requestTerm := heartbeatRequest.GetTerm(); requestTerm >= rs.term.Load() {
-		rs.term.Store(requestTerm)
-		select {
-		case rs.heartbeats <- heartbeatRequest.GetLeaderAddress():
-		case <-time.After(waitFollowerStateTimeout):
-			return nil, errors.New("replica is not in follower state")
-		case <-ctx.Done():
-			return nil, ctx.Err()
+// Entries returns at most max entries starting from index with the term of preceding entry
+func (rs *ReplicaServer) Entries(from uint64, max int) (prevLogTerm uint64, entries []*protocol.LogEntry, ok bool) {
+	rs.logMux.Lock()
+	defer rs.logMux.Unlock()
+	if prevLogTerm, ok = rs.log.term(from - 1); !ok {
+		return 0, nil, false
+	}
+	return prevLogTerm, rs.log.slice(from, rs.log.lastIndex(), max), true
+}
+
+func (rs *ReplicaServer) LastLogIndex() uint64 {
+	rs.logMux.Lock()
+	defer rs.logMux.Unlock()
+	return rs.log.lastIndex()
+}
+
+func (rs *ReplicaServer) LastLog() (index, term uint64) {
+	rs.logMux.Lock()
+	defer rs.logMux.Unlock()
+	return rs.log.lastIndex(), rs.log.lastTerm()
+}
+
+func (rs *ReplicaServer) CommitIndex() uint64 {
+	rs.logMux.Lock()
+	defer rs.logMux.Unlock()
+	return rs.commitIndex
+}
+
+// Commit advances commit index of the leader,
+// only entries of the current term are committed by counting replicas
+func (rs *ReplicaServer) Commit(index uint64) {
+	rs.logMux.Lock()
+	defer rs.logMux.Unlock()
+	if term, ok := rs.log.term(index); !ok || term != rs.term.Load() {
+		return
+	}
+	rs.commitLocked(index)
+}
+
+func (rs *ReplicaServer) commitLocked(index uint64) {
+	if index <= rs.commitIndex {
+		return
+	}
+	rs.commitIndex = index
+	select {
+	case rs.commits <- struct{}{}:
+	default:
+	}
+}
+
+func (rs *ReplicaServer) AppendEntries(ctx context.Context, request *protocol.AppendEntriesRequest) (*protocol.AppendEntriesResponse, error) {
+	rs.logMux.Lock()
+	response, err := rs.appendEntriesLocked(request)
+	rs.logMux.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if request.GetTerm() >= response.GetTerm() {
+		rs.notify(ctx, rs.heartbeats, request.GetLeaderAddress())
+	}
+	return response, nil
+}
+
+func (rs *ReplicaServer) appendEntriesLocked(request *protocol.AppendEntriesRequest) (*protocol.AppendEntriesResponse, error) {
+	requestTerm := request.GetTerm()
+	if requestTerm < rs.term.Load() {
+		return &protocol.AppendEntriesResponse{Term: rs.term.Load(), Success: false}, nil
+	}
+	// candidate of the same term lost elections, leader of the same term can't exist
+	if err := rs.stepDownLocked(requestTerm); err != nil {
+		return nil, err
+	}
+	rs.leaderContact = time.Now()
+	rs.setLeaderLocked(request.GetLeaderAddress())
+
+	prevLogIndex := request.GetPrevLogIndex()
+	if term, ok := rs.log.term(prevLogIndex); !ok || term != request.GetPrevLogTerm() {
+		// hint leader to continue from the end of our log or from the conflicting entry
+		hint := rs.log.lastIndex()
+		if prevLogIndex <= hint && prevLogIndex > 0 {
+			hint = prevLogIndex - 1
+		}
+		return &protocol.AppendEntriesResponse{Term: requestTerm, Success: false, MatchIndex: hint}, nil
+	}
+
+	for i, entry := range request.GetEntries() {
+		term, ok := rs.log.term(entry.GetIndex())
+		if ok && term == entry.GetTerm() {
+			continue // already have it
+		}
+		if ok {
+			if err := rs.truncateLocked(entry.GetIndex()); err != nil {
+				return nil, err
+			}
+		}
+		if err := rs.store.Append(request.GetEntries()[i:]...); err != nil {
+			return nil, fmt.Errorf("error persisting entries: %w", err)
 		}
-		return &protocol.HeartbeatResponse{Ok: true}, nil
+		rs.log.append(request.GetEntries()[i:]...)
+		break
 	}
-	return &protocol.HeartbeatResponse{Ok: false}, nil
+
+	matchIndex := prevLogIndex + uint64(len(request.GetEntries()))
+	commitIndex := request.GetLeaderCommit()
+	if commitIndex > matchIndex {
+		commitIndex = matchIndex
+	}
+	rs.commitLocked(commitIndex)
+	return &protocol.AppendEntriesResponse{Term: requestTerm, Success: true, MatchIndex: matchIndex}, nil
+}
+
+// truncateLocked removes conflicting entries, results of removed entries are failed
+func (rs *ReplicaServer) truncateLocked(from uint64) error {
+	if err := rs.store.Truncate(from); err != nil {
+		return fmt.Errorf("error truncating log: %w", err)
+	}
+	for index := from; index <= rs.log.lastIndex(); index++ {
+		if result, ok := rs.results[index]; ok {
+			result <- ErrEntryOverwritten
+			delete(rs.results, index)
+		}
+	}
+	rs.log.truncate(from)
+	return nil
+}
+
+// notify wakes up follower loop of the replica, the loop doesn't listen while replica is in other states
+func (rs *ReplicaServer) notify(ctx context.Context, events chan string, address string) {
+	select {
+	case events <- address:
+	case <-time.After(waitFollowerStateTimeout):
+	case <-ctx.Done():
+	}
+}
+
+// ObserveTerm steps down to follower if term from response of another replica is newer
+func (rs *ReplicaServer) ObserveTerm(term uint64) error {
+	rs.logMux.Lock()
+	defer rs.logMux.Unlock()
+	if term <= rs.term.Load() {
+		return nil
+	}
+	return rs.stepDownLocked(term)
+}
+
+// stepDownLocked changes state to follower, newer term resets vote
+func (rs *ReplicaServer) stepDownLocked(term uint64) error {
+	if term > rs.term.Load() {
+		if err := rs.setTermLocked(term, ""); err != nil {
+			return err
+		}
+	}
+	rs.setStateLocked(Follower)
+	return nil
+}
+
+// setTermLocked persists term and vote before they're used
+func (rs *ReplicaServer) setTermLocked(term uint64, votedFor string) error {
+	if err := rs.store.SaveState(raftstore.State{Term: term, VotedFor: votedFor}); err != nil {
+		return fmt.Errorf("error persisting term: %w", err)
+	}
+	termChanged := term != rs.term.Load()
+	rs.term.Store(term)
+	rs.votedFor = votedFor
+	if termChanged {
+		rs.setLeaderLocked("") // leader of the new term isn't known yet
+	}
+	return nil
 }
 
 func (rs *ReplicaServer) SendElectionRequest(ctx context.Context, request *protocol.ElectionRequest) (*protocol.ElectionResponse, error) {
+	rs.logMux.Lock()
+	response, err := rs.electionRequestLocked(request)
+	rs.logMux.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if response.GetVote() && !request.GetPreVote() {
+		rs.notify(ctx, rs.electionRequests, request.GetAddress())
+	}
+	return response, nil
+}
 
-	if requestTerm := request.GetTerm(); requestTerm > rs.term.Load() {
-		rs.term.Store(requestTerm)
-		select {
-		case rs.electionRequests <- request.GetAddress():
-			return &protocol.ElectionResponse{Vote: true}, nil
-		case <-time.After(waitFollowerStateTimeout):
-			return nil, errors.New("replica is not in follower state")
-		case <-ctx.Done():
-			return nil, ctx.Err()
+func (rs *ReplicaServer) electionRequestLocked(request *protocol.ElectionRequest) (*protocol.ElectionResponse, error) {
+	term := rs.term.Load()
+	if request.GetTerm() < term {
+		return &protocol.ElectionResponse{Vote: false, Term: term}, nil
+	}
+
+	if request.GetPreVote() {
+		// replica doesn't support candidates while it hears from the leader,
+		// so a replica rejoining after partition can't disrupt the cluster
+		leaderAlive := rs.GetState() == Leader || time.Since(rs.leaderContact) < rs.leaderLease
+		vote := request.GetTerm() > term && !leaderAlive && rs.logUpToDateLocked(request)
+		return &protocol.ElectionResponse{Vote: vote, Term: term}, nil
+	}
+
+	if request.GetTerm() > term {
+		if err := rs.stepDownLocked(request.GetTerm()); err != nil {
+			return nil, err
 		}
+		term = request.GetTerm()
+	}
+	if rs.votedFor != "" && rs.votedFor != request.GetAddress() || !rs.logUpToDateLocked(request) {
+		return &protocol.ElectionResponse{Vote: false, Term: term}, nil
 	}
-	return &protocol.ElectionResponse{Vote: false}, nil
+	if err := rs.setTermLocked(term, request.GetAddress()); err != nil {
+		return nil, err
+	}
+	return &protocol.ElectionResponse{Vote: true, Term: term}, nil
+}
+
+// logUpToDateLocked checks that candidate's log has all entries which could be committed
+func (rs *ReplicaServer) logUpToDateLocked(request *protocol.ElectionRequest) bool {
+	lastTerm := rs.log.lastTerm()
+	if request.GetLastLogTerm() != lastTerm {
+		return request.GetLastLogTerm() > lastTerm
+	}
+	return request.GetLastLogIndex() >= rs.log.lastIndex()
 }
 
 func (rs *ReplicaServer) SetState(state State) {
-	rs.state.Store(uint32(state))
+	rs.logMux.Lock()
+	defer rs.logMux.Unlock()
+	rs.setStateLocked(state)
+}
+
+// setStateLocked changes state, leader which loses leadership doesn't know the next leader
+func (rs *ReplicaServer) setStateLocked(state State) {
+	previous := State(rs.state.Swap(uint32(state)))
+	if previous == Leader && state != Leader {
+		rs.setLeaderLocked("")
+	}
 }
 
 func (rs *ReplicaServer) GetState() State {
 	return State(rs.state.Load())
 }
 
-func (rs *ReplicaServer) NewTerm() uint64 {
-	rs.term.Add(1)
-	return rs.term.Load()
+// NewTerm starts term of elections with vote for itself
+func (rs *ReplicaServer) NewTerm() (uint64, error) {
+	rs.logMux.Lock()
+	defer rs.logMux.Unlock()
+	term := rs.term.Load() + 1
+	if err := rs.setTermLocked(term, rs.storage.GetMyAddress()); err != nil {
+		return 0, err
+	}
+	return term, nil
+}
+
+// Promote makes candidate a leader if it's still a candidate of the term
+func (rs *ReplicaServer) Promote(term uint64) bool {
+	rs.logMux.Lock()
+	defer rs.logMux.Unlock()
+	if rs.term.Load() != term || rs.GetState() != Candidate {
+		return false
+	}
+	rs.setStateLocked(Leader)
+	rs.setLeaderLocked(rs.storage.GetMyAddress())
+	return true
+}
+
+// SetLeaderLease sets time after the last append entries request while pre-votes are rejected,
+// it shouldn't exceed the minimal election timeout
+func (rs *ReplicaServer) SetLeaderLease(lease time.Duration) {
+	rs.logMux.Lock()
+	defer rs.logMux.Unlock()
+	rs.leaderLease = lease
 }
 
 func (rs *ReplicaServer) GetTerm() uint64 {
@@ -136,3 +566,8 @@ func (rs *ReplicaServer) IncomingElectionRequests() chan string {
 func (rs *ReplicaServer) IncomingHeartbeats() chan string {
 	return rs.heartbeats
 }
+
+// IncomingProposals notifies the leader about new entries which should be replicated without waiting for heartbeat
+func (rs *ReplicaServer) IncomingProposals() <-chan struct{} {
+	return rs.proposals
+}
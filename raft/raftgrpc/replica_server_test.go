@@ -0,0 +1,304 @@
+package raftgrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/einherij/enterprise/raft/raftgrpc/protocol"
+	"github.com/einherij/enterprise/raft/raftstorage"
+	"github.com/einherij/enterprise/raft/raftstore"
+)
+
+type ReplicaServerSuite struct {
+	suite.Suite
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	server *ReplicaServer
+}
+
+func TestReplicaServer(t *testing.T) {
+	suite.Run(t, new(ReplicaServerSuite))
+}
+
+func (s *ReplicaServerSuite) SetupTest() {
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	var err error
+	s.server, err = NewReplicaServer(raftstorage.NewDummyStorage("a", "a", "b", "c"))
+	s.Require().NoError(err)
+	// follower loop of the replica
+	ctx, heartbeats := s.ctx, s.server.IncomingHeartbeats()
+	go func() {
+		for {
+			select {
+			case <-heartbeats:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (s *ReplicaServerSuite) TearDownTest() {
+	s.cancel()
+}
+
+func entry(index, term uint64, data string) *protocol.LogEntry {
+	return &protocol.LogEntry{Index: index, Term: term, CommandName: "set", SharedData: []byte(data)}
+}
+
+func (s *ReplicaServerSuite) appendEntries(request *protocol.AppendEntriesRequest) *protocol.AppendEntriesResponse {
+	response, err := s.server.AppendEntries(s.ctx, request)
+	s.Require().NoError(err)
+	return response
+}
+
+func (s *ReplicaServerSuite) TestAppendEntries() {
+	response := s.appendEntries(&protocol.AppendEntriesRequest{
+		Term:    1,
+		Entries: []*protocol.LogEntry{entry(1, 1, "x"), entry(2, 1, "y"), entry(3, 1, "z")},
+	})
+	s.True(response.GetSuccess())
+	s.EqualValues(3, response.GetMatchIndex())
+
+	// gap in the log, leader should continue after the last entry
+	response = s.appendEntries(&protocol.AppendEntriesRequest{Term: 1, PrevLogIndex: 5, PrevLogTerm: 1})
+	s.False(response.GetSuccess())
+	s.EqualValues(3, response.GetMatchIndex())
+
+	// term of the previous entry differs, leader should step back
+	response = s.appendEntries(&protocol.AppendEntriesRequest{Term: 2, PrevLogIndex: 3, PrevLogTerm: 2})
+	s.False(response.GetSuccess())
+	s.EqualValues(2, response.GetMatchIndex())
+
+	// conflicting entry and entries after it are replaced
+	response = s.appendEntries(&protocol.AppendEntriesRequest{
+		Term:         2,
+		PrevLogIndex: 1,
+		PrevLogTerm:  1,
+		Entries:      []*protocol.LogEntry{entry(2, 1, "y"), entry(3, 2, "w")},
+		LeaderCommit: 5,
+	})
+	s.True(response.GetSuccess())
+	s.EqualValues(3, response.GetMatchIndex())
+	s.EqualValues(3, s.server.LastLogIndex())
+	s.EqualValues(3, s.server.CommitIndex())
+	_, entries, ok := s.server.Entries(3, 10)
+	s.True(ok)
+	s.Equal("w", string(entries[0].GetSharedData()))
+
+	// stale leader is rejected
+	response = s.appendEntries(&protocol.AppendEntriesRequest{Term: 1})
+	s.False(response.GetSuccess())
+	s.EqualValues(2, response.GetTerm())
+}
+
+func (s *ReplicaServerSuite) becomeLeader() uint64 {
+	term, err := s.server.NewTerm()
+	s.Require().NoError(err)
+	s.server.SetState(Candidate)
+	s.Require().True(s.server.Promote(term))
+	return term
+}
+
+func (s *ReplicaServerSuite) TestApplyInOrder() {
+	var applied []string
+	s.server.AddCommand("set", func(ctx context.Context, myAddress string, myState State, replicaCount int, sharedData []byte) error {
+		s.Equal("a", myAddress)
+		s.Equal(3, replicaCount)
+		applied = append(applied, string(sharedData))
+		return nil
+	})
+	s.becomeLeader()
+	_, first, err := s.server.Propose("", "set", []byte("1"))
+	s.Require().NoError(err)
+	_, second, err := s.server.Propose("", "set", []byte("2"))
+	s.Require().NoError(err)
+	_, unknown, err := s.server.Propose("", "get", nil)
+	s.Require().NoError(err)
+
+	// entry of the current term commits preceding entries
+	s.server.Commit(3)
+	s.server.applyCommitted(s.ctx)
+	s.NoError(<-first)
+	s.NoError(<-second)
+	s.ErrorIs(<-unknown, ErrUnknownCommand)
+	s.Equal([]string{"1", "2"}, applied)
+}
+
+func (s *ReplicaServerSuite) TestReplayAfterRestart() {
+	var (
+		store   = raftstore.NewMemoryStore()
+		storage = raftstorage.NewDummyStorage("a", "a", "b", "c")
+		applied []string
+		command = func(ctx context.Context, myAddress string, myState State, replicaCount int, sharedData []byte) error {
+			applied = append(applied, string(sharedData))
+			return nil
+		}
+	)
+	server, err := NewReplicaServer(storage, WithStore(store))
+	s.Require().NoError(err)
+	server.AddCommand("set", command)
+	term, err := server.NewTerm()
+	s.Require().NoError(err)
+	server.SetState(Candidate)
+	s.Require().True(server.Promote(term))
+	for _, data := range []string{"1", "2"} {
+		_, _, err = server.Propose("req", "set", []byte(data)) // retried request
+		s.Require().NoError(err)
+	}
+	_, _, err = server.Propose("", "set", []byte("3"))
+	s.Require().NoError(err)
+	server.Commit(3)
+	server.applyCommitted(s.ctx)
+	s.Equal([]string{"1", "3"}, applied)
+
+	// restarted replica applies the log from the beginning and skips the same repeated request
+	applied = nil
+	server, err = NewReplicaServer(storage, WithStore(store))
+	s.Require().NoError(err)
+	server.AddCommand("set", command)
+	response, err := server.AppendEntries(s.ctx, &protocol.AppendEntriesRequest{
+		Term:         term,
+		PrevLogIndex: 3,
+		PrevLogTerm:  term,
+		LeaderCommit: 3,
+	})
+	s.Require().NoError(err)
+	s.True(response.GetSuccess())
+	server.applyCommitted(s.ctx)
+	s.Equal([]string{"1", "3"}, applied)
+}
+
+func (s *ReplicaServerSuite) TestOverwrittenProposal() {
+	s.becomeLeader()
+	_, result, err := s.server.Propose("", "set", []byte("1"))
+	s.Require().NoError(err)
+
+	response := s.appendEntries(&protocol.AppendEntriesRequest{
+		Term:    2,
+		Entries: []*protocol.LogEntry{entry(1, 2, "2")},
+	})
+	s.True(response.GetSuccess())
+	s.ErrorIs(<-result, ErrEntryOverwritten)
+}
+
+func (s *ReplicaServerSuite) requestVote(request *protocol.ElectionRequest) *protocol.ElectionResponse {
+	response, err := s.server.SendElectionRequest(s.ctx, request)
+	s.Require().NoError(err)
+	return response
+}
+
+func (s *ReplicaServerSuite) TestSingleVotePerTerm() {
+	s.True(s.requestVote(&protocol.ElectionRequest{Address: "b", Term: 1}).GetVote())
+	s.True(s.requestVote(&protocol.ElectionRequest{Address: "b", Term: 1}).GetVote(), "repeated request")
+	s.False(s.requestVote(&protocol.ElectionRequest{Address: "c", Term: 1}).GetVote())
+
+	// vote is persisted and survives restart
+	store := raftstore.NewMemoryStore()
+	server, err := NewReplicaServer(raftstorage.NewDummyStorage("a", "a", "b", "c"), WithStore(store))
+	s.Require().NoError(err)
+	_, err = server.SendElectionRequest(s.ctx, &protocol.ElectionRequest{Address: "b", Term: 1})
+	s.Require().NoError(err)
+	server, err = NewReplicaServer(raftstorage.NewDummyStorage("a", "a", "b", "c"), WithStore(store))
+	s.Require().NoError(err)
+	response, err := server.SendElectionRequest(s.ctx, &protocol.ElectionRequest{Address: "c", Term: 1})
+	s.Require().NoError(err)
+	s.False(response.GetVote())
+
+	// newer term resets vote
+	response = s.requestVote(&protocol.ElectionRequest{Address: "c", Term: 2})
+	s.True(response.GetVote())
+	s.EqualValues(2, response.GetTerm())
+
+	response = s.requestVote(&protocol.ElectionRequest{Address: "b", Term: 1})
+	s.False(response.GetVote())
+	s.EqualValues(2, response.GetTerm())
+}
+
+func (s *ReplicaServerSuite) TestVoteForUpToDateLog() {
+	s.appendEntries(&protocol.AppendEntriesRequest{
+		Term:    2,
+		Entries: []*protocol.LogEntry{entry(1, 1, "x"), entry(2, 2, "y")},
+	})
+
+	s.False(s.requestVote(&protocol.ElectionRequest{Address: "b", Term: 3, LastLogIndex: 5, LastLogTerm: 1}).GetVote())
+	s.False(s.requestVote(&protocol.ElectionRequest{Address: "b", Term: 3, LastLogIndex: 1, LastLogTerm: 2}).GetVote())
+	s.True(s.requestVote(&protocol.ElectionRequest{Address: "b", Term: 3, LastLogIndex: 2, LastLogTerm: 2}).GetVote())
+	s.True(s.requestVote(&protocol.ElectionRequest{Address: "c", Term: 4, LastLogIndex: 1, LastLogTerm: 3}).GetVote())
+}
+
+func (s *ReplicaServerSuite) TestStepDown() {
+	term, err := s.server.NewTerm()
+	s.Require().NoError(err)
+	s.server.SetState(Candidate)
+	s.True(s.server.Promote(term))
+	s.Equal(Leader, s.server.GetState())
+
+	s.NoError(s.server.ObserveTerm(term))
+	s.Equal(Leader, s.server.GetState())
+	s.NoError(s.server.ObserveTerm(term + 1))
+	s.Equal(Follower, s.server.GetState())
+	s.Equal(term+1, s.server.GetTerm())
+
+	// candidate loses elections when leader of the same term appears
+	term, err = s.server.NewTerm()
+	s.Require().NoError(err)
+	s.server.SetState(Candidate)
+	s.True(s.appendEntries(&protocol.AppendEntriesRequest{Term: term}).GetSuccess())
+	s.Equal(Follower, s.server.GetState())
+	s.False(s.server.Promote(term))
+}
+
+func (s *ReplicaServerSuite) TestPreVote() {
+	preVote := &protocol.ElectionRequest{Address: "b", Term: 1, PreVote: true}
+	s.True(s.requestVote(preVote).GetVote())
+	s.EqualValues(0, s.server.GetTerm(), "pre-vote doesn't change term")
+
+	// replica hearing from the leader doesn't support elections
+	s.server.SetLeaderLease(time.Minute)
+	s.appendEntries(&protocol.AppendEntriesRequest{Term: 1})
+	preVote.Term = 2
+	s.False(s.requestVote(preVote).GetVote())
+	s.server.SetLeaderLease(0)
+	s.True(s.requestVote(preVote).GetVote())
+
+	preVote.Term = 1
+	response := s.requestVote(preVote)
+	s.False(response.GetVote())
+	s.EqualValues(1, response.GetTerm())
+}
+
+func (s *ReplicaServerSuite) TestLeadershipChanges() {
+	changes, unsubscribe := s.server.LeadershipChanges()
+	defer unsubscribe()
+
+	term := s.becomeLeader()
+	s.Equal(Leadership{Leader: "a", Term: term, IsLeader: true}, <-changes)
+	s.Equal("a", s.server.Leader())
+
+	s.appendEntries(&protocol.AppendEntriesRequest{Term: term + 1, LeaderAddress: "b"})
+	s.Equal(Leadership{Leader: "b", Term: term + 1}, <-changes, "only the latest change is kept")
+	s.Equal("b", s.server.Leader())
+	_, _, err := s.server.Propose("", "set", nil)
+	s.ErrorIs(err, ErrNotLeader)
+
+	// heartbeats of the same leader don't produce changes
+	s.appendEntries(&protocol.AppendEntriesRequest{Term: term + 1, LeaderAddress: "b"})
+	s.Empty(changes)
+
+	s.requestVote(&protocol.ElectionRequest{Address: "c", Term: term + 2})
+	s.Equal(Leadership{Term: term + 2}, <-changes)
+	s.Empty(s.server.Leader())
+}
+
+func (s *ReplicaServerSuite) TestExecuteCommandOnFollower() {
+	s.appendEntries(&protocol.AppendEntriesRequest{Term: 1, LeaderAddress: "b"})
+	response, err := s.server.ExecuteCommand(s.ctx, &protocol.ExecuteCommandRequest{CommandName: "set"})
+	s.Require().NoError(err)
+	s.True(response.GetNotLeader())
+	s.Equal("b", response.GetLeaderAddress())
+}
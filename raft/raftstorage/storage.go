@@ -8,8 +8,8 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
-	"github.com/sirupsen/logrus"
 
+	"github.com/einherij/enterprise/logging"
 	"github.com/einherij/enterprise/utils"
 )
 
@@ -29,10 +29,20 @@ type ReplicaStorage struct {
 	myAddress   string
 	serviceName string
 	redisClient *redis.Client
-	logger      *logrus.Logger
+	logger      logging.Logger
 }
 
-func NewReplicaStorage(myAddress string, serviceName string, redisClient *redis.Client) *ReplicaStorage {
+// Option configures ReplicaStorage
+type Option func(rs *ReplicaStorage)
+
+// WithLogger sets storage logger, by default logger of "raft_storage" component is used
+func WithLogger(logger logging.Logger) Option {
+	return func(rs *ReplicaStorage) {
+		rs.logger = logger
+	}
+}
+
+func NewReplicaStorage(myAddress string, serviceName string, redisClient *redis.Client, opts ...Option) *ReplicaStorage {
 	if myAddress == "" {
 		panic(errors.New("empty self my_address"))
 	}
@@ -43,7 +53,10 @@ func NewReplicaStorage(myAddress string, serviceName string, redisClient *redis.
 		myAddress:   myAddress,
 		serviceName: serviceName,
 		redisClient: redisClient,
-		logger:      logrus.New(),
+		logger:      logging.Component("raft_storage"),
+	}
+	for _, opt := range opts {
+		opt(rs)
 	}
 	return rs
 }
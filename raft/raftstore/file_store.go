@@ -0,0 +1,463 @@
+package raftstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/einherij/enterprise/raft/raftgrpc/protocol"
+)
+
+const (
+	defaultSegmentSize = 64 << 20
+
+	stateFileName  = "state"
+	segmentExt     = ".log"
+	recordHeader   = 8 // payload length and checksum
+	maxRecordSize  = 1 << 30
+	segmentNameLen = 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// FileStore keeps state in a file which is replaced atomically
+// and log entries in append-only segment files, every segment is named by index of its first entry.
+// A segment consists of records: payload length, CRC-32C of payload and protobuf encoded entry.
+// Every write is synced to disk before it returns.
+type FileStore struct {
+	dir         string
+	segmentSize int64
+
+	mux       sync.Mutex
+	segments  []*segment
+	active    *os.File // file of the last segment
+	lastIndex uint64
+}
+
+type segment struct {
+	firstIndex uint64
+	path       string
+	// offsets of records, the last one is the size of the segment
+	offsets []int64
+}
+
+func (s *segment) size() int64 {
+	return s.offsets[len(s.offsets)-1]
+}
+
+var _ Store = (*FileStore)(nil)
+
+// FileOption configures FileStore
+type FileOption func(fs *FileStore)
+
+// WithSegmentSize sets size after which a new segment file is started, 64MB by default
+func WithSegmentSize(size int64) FileOption {
+	return func(fs *FileStore) {
+		fs.segmentSize = size
+	}
+}
+
+// OpenFileStore opens store in the directory creating it if needed.
+// Incomplete or corrupted records at the end of the last segment are left by interrupted writes,
+// they are removed on recovery, corruption of other records is returned as ErrCorrupted.
+func OpenFileStore(dir string, opts ...FileOption) (*FileStore, error) {
+	fs := &FileStore{
+		dir:         dir,
+		segmentSize: defaultSegmentSize,
+	}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating directory: %w", err)
+	}
+	if _, err := fs.loadState(); err != nil {
+		return nil, err
+	}
+	if err := fs.recover(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *FileStore) Load() (State, []*protocol.LogEntry, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	state, err := fs.loadState()
+	if err != nil {
+		return State{}, nil, err
+	}
+	var entries []*protocol.LogEntry
+	for _, seg := range fs.segments {
+		segmentEntries, _, err := readSegment(seg.path)
+		if err != nil {
+			return State{}, nil, err
+		}
+		if uint64(len(segmentEntries)) < uint64(len(seg.offsets)-1) {
+			return State{}, nil, fmt.Errorf("%w: segment %s is shorter than recovered", ErrCorrupted, seg.path)
+		}
+		entries = append(entries, segmentEntries[:len(seg.offsets)-1]...)
+	}
+	return state, entries, nil
+}
+
+func (fs *FileStore) SaveState(state State) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 4)) // checksum
+	_ = binary.Write(&buf, binary.LittleEndian, state.Term)
+	buf.WriteString(state.VotedFor)
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint32(data, crc32.Checksum(data[4:], crcTable))
+
+	tmpPath := filepath.Join(fs.dir, stateFileName+".tmp")
+	if err := writeFileSync(tmpPath, data); err != nil {
+		return fmt.Errorf("error writing state: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(fs.dir, stateFileName)); err != nil {
+		return fmt.Errorf("error replacing state: %w", err)
+	}
+	return syncDir(fs.dir)
+}
+
+func (fs *FileStore) loadState() (State, error) {
+	data, err := os.ReadFile(filepath.Join(fs.dir, stateFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, nil
+	} else if err != nil {
+		return State{}, fmt.Errorf("error reading state: %w", err)
+	}
+	if len(data) < 12 || binary.LittleEndian.Uint32(data) != crc32.Checksum(data[4:], crcTable) {
+		return State{}, fmt.Errorf("%w: invalid state file", ErrCorrupted)
+	}
+	return State{
+		Term:     binary.LittleEndian.Uint64(data[4:12]),
+		VotedFor: string(data[12:]),
+	}, nil
+}
+
+func (fs *FileStore) Append(entries ...*protocol.LogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := checkContinuity(fs.lastIndex, entries); err != nil {
+		return err
+	}
+
+	if len(fs.segments) == 0 || fs.segments[len(fs.segments)-1].size() >= fs.segmentSize {
+		if err := fs.startSegment(entries[0].GetIndex()); err != nil {
+			return err
+		}
+	}
+	seg := fs.segments[len(fs.segments)-1]
+
+	var (
+		buf     bytes.Buffer
+		offsets = make([]int64, 0, len(entries))
+		offset  = seg.size()
+	)
+	for _, entry := range entries {
+		record, err := encodeRecord(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(record)
+		offset += int64(len(record))
+		offsets = append(offsets, offset)
+	}
+	if _, err := fs.active.Write(buf.Bytes()); err != nil {
+		return fs.rollbackAppend(seg, fmt.Errorf("error writing segment: %w", err))
+	}
+	if err := fs.active.Sync(); err != nil {
+		return fs.rollbackAppend(seg, fmt.Errorf("error syncing segment: %w", err))
+	}
+	seg.offsets = append(seg.offsets, offsets...)
+	fs.lastIndex += uint64(len(entries))
+	return nil
+}
+
+// rollbackAppend removes partially written records, so next append doesn't follow garbage
+func (fs *FileStore) rollbackAppend(seg *segment, err error) error {
+	if truncateErr := fs.active.Truncate(seg.size()); truncateErr != nil {
+		return errors.Join(err, truncateErr)
+	}
+	if _, seekErr := fs.active.Seek(seg.size(), io.SeekStart); seekErr != nil {
+		return errors.Join(err, seekErr)
+	}
+	return err
+}
+
+func (fs *FileStore) startSegment(firstIndex uint64) error {
+	if fs.active != nil {
+		if err := fs.active.Close(); err != nil {
+			return fmt.Errorf("error closing segment: %w", err)
+		}
+		fs.active = nil
+	}
+	path := filepath.Join(fs.dir, segmentName(firstIndex))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("error creating segment: %w", err)
+	}
+	if err = syncDir(fs.dir); err != nil {
+		_ = file.Close()
+		return err
+	}
+	fs.active = file
+	fs.segments = append(fs.segments, &segment{firstIndex: firstIndex, path: path, offsets: []int64{0}})
+	return nil
+}
+
+func (fs *FileStore) Truncate(from uint64) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if from == 0 {
+		from = 1
+	}
+	if from > fs.lastIndex {
+		return nil
+	}
+
+	for len(fs.segments) > 0 {
+		seg := fs.segments[len(fs.segments)-1]
+		if seg.firstIndex < from {
+			break
+		}
+		if err := fs.closeActive(); err != nil {
+			return err
+		}
+		if err := os.Remove(seg.path); err != nil {
+			return fmt.Errorf("error removing segment: %w", err)
+		}
+		fs.segments = fs.segments[:len(fs.segments)-1]
+	}
+	if err := syncDir(fs.dir); err != nil {
+		return err
+	}
+	fs.lastIndex = from - 1
+	if len(fs.segments) == 0 {
+		return nil
+	}
+
+	seg := fs.segments[len(fs.segments)-1]
+	if fs.active == nil {
+		file, err := os.OpenFile(seg.path, os.O_RDWR, 0o644)
+		if err != nil {
+			return fmt.Errorf("error opening segment: %w", err)
+		}
+		fs.active = file
+	}
+	seg.offsets = seg.offsets[:from-seg.firstIndex+1]
+	if err := fs.active.Truncate(seg.size()); err != nil {
+		return fmt.Errorf("error truncating segment: %w", err)
+	}
+	if err := fs.active.Sync(); err != nil {
+		return fmt.Errorf("error syncing segment: %w", err)
+	}
+	if _, err := fs.active.Seek(seg.size(), io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking segment: %w", err)
+	}
+	return nil
+}
+
+func (fs *FileStore) closeActive() error {
+	if fs.active == nil {
+		return nil
+	}
+	err := fs.active.Close()
+	fs.active = nil
+	if err != nil {
+		return fmt.Errorf("error closing segment: %w", err)
+	}
+	return nil
+}
+
+func (fs *FileStore) Close() error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	return fs.closeActive()
+}
+
+// recover reads all segments checking indexes and checksums,
+// the last segment is truncated after the last valid record if it's followed only by a torn write
+func (fs *FileStore) recover() error {
+	dirEntries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return fmt.Errorf("error reading directory: %w", err)
+	}
+	var names []string
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() && strings.HasSuffix(dirEntry.Name(), segmentExt) {
+			names = append(names, dirEntry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		firstIndex, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: unexpected segment name %s", ErrCorrupted, name)
+		}
+		if firstIndex != fs.lastIndex+1 {
+			return fmt.Errorf("%w: segment %s doesn't follow index %d", ErrCorrupted, name, fs.lastIndex)
+		}
+		path := filepath.Join(fs.dir, name)
+		entries, offsets, err := readSegment(path)
+		if err != nil {
+			return err
+		}
+		if err = checkContinuity(fs.lastIndex, entries); err != nil {
+			return fmt.Errorf("%w: segment %s: %v", ErrCorrupted, name, err)
+		}
+
+		isLast := i == len(names)-1
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("error reading segment: %w", err)
+		}
+		validSize := offsets[len(offsets)-1]
+		if validSize < info.Size() && !isLast {
+			return fmt.Errorf("%w: invalid record in segment %s at offset %d", ErrCorrupted, name, validSize)
+		}
+
+		fs.segments = append(fs.segments, &segment{firstIndex: firstIndex, path: path, offsets: offsets})
+		fs.lastIndex += uint64(len(entries))
+		if !isLast {
+			continue
+		}
+		file, err := os.OpenFile(path, os.O_RDWR, 0o644)
+		if err != nil {
+			return fmt.Errorf("error opening segment: %w", err)
+		}
+		fs.active = file
+		if validSize < info.Size() {
+			if err = file.Truncate(validSize); err != nil {
+				return fmt.Errorf("error truncating torn segment: %w", err)
+			}
+			if err = file.Sync(); err != nil {
+				return fmt.Errorf("error syncing segment: %w", err)
+			}
+		}
+		if _, err = file.Seek(validSize, io.SeekStart); err != nil {
+			return fmt.Errorf("error seeking segment: %w", err)
+		}
+	}
+	return nil
+}
+
+// readSegment returns entries of valid records and their offsets, the last offset is the end of the last valid record.
+// Invalid record followed by a valid one isn't a torn write, it's returned as ErrCorrupted.
+func readSegment(path string) (entries []*protocol.LogEntry, offsets []int64, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading segment: %w", err)
+	}
+	var offset int64
+	offsets = []int64{0}
+	for {
+		entry, size, ok := decodeRecord(data[offset:])
+		if !ok {
+			if recordFollows(data[offset:]) {
+				return nil, nil, fmt.Errorf("%w: invalid record in segment %s at offset %d", ErrCorrupted, path, offset)
+			}
+			return entries, offsets, nil
+		}
+		entries = append(entries, entry)
+		offset += size
+		offsets = append(offsets, offset)
+	}
+}
+
+func encodeRecord(entry *protocol.LogEntry) ([]byte, error) {
+	payload, err := proto.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding entry: %w", err)
+	}
+	record := make([]byte, recordHeader+len(payload))
+	binary.LittleEndian.PutUint32(record, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:], crc32.Checksum(payload, crcTable))
+	copy(record[recordHeader:], payload)
+	return record, nil
+}
+
+func decodeRecord(data []byte) (entry *protocol.LogEntry, size int64, ok bool) {
+	if len(data) < recordHeader {
+		return nil, 0, false
+	}
+	length := binary.LittleEndian.Uint32(data)
+	if length > maxRecordSize || uint64(len(data)-recordHeader) < uint64(length) {
+		return nil, 0, false
+	}
+	payload := data[recordHeader : recordHeader+int(length)]
+	if binary.LittleEndian.Uint32(data[4:]) != crc32.Checksum(payload, crcTable) {
+		return nil, 0, false
+	}
+	entry = &protocol.LogEntry{}
+	if err := proto.Unmarshal(payload, entry); err != nil {
+		return nil, 0, false
+	}
+	return entry, int64(recordHeader + length), true
+}
+
+// recordFollows checks if invalid record at the beginning of data is followed by a valid record
+func recordFollows(data []byte) bool {
+	if len(data) < recordHeader {
+		return false
+	}
+	length := binary.LittleEndian.Uint32(data)
+	if length > maxRecordSize || uint64(len(data)-recordHeader) <= uint64(length) {
+		return false
+	}
+	_, _, ok := decodeRecord(data[recordHeader+int(length):])
+	return ok
+}
+
+func segmentName(firstIndex uint64) string {
+	return fmt.Sprintf("%0*d%s", segmentNameLen, firstIndex, segmentExt)
+}
+
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// syncDir makes creation, removal and renaming of files in the directory durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("error opening directory: %w", err)
+	}
+	defer func() {
+		_ = d.Close()
+	}()
+	if err = d.Sync(); err != nil {
+		return fmt.Errorf("error syncing directory: %w", err)
+	}
+	return nil
+}
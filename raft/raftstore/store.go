@@ -0,0 +1,95 @@
+package raftstore
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/einherij/enterprise/raft/raftgrpc/protocol"
+)
+
+var (
+	ErrIndexGap  = errors.New("appended entry doesn't follow the last entry")
+	ErrCorrupted = errors.New("raft store is corrupted")
+)
+
+// State is persisted before replica responds to any request which changes it
+type State struct {
+	Term     uint64
+	VotedFor string
+}
+
+// Store keeps raft state and log entries which must survive restarts of the replica
+type Store interface {
+	// Load returns persisted state and all log entries, the first entry has index 1
+	Load() (State, []*protocol.LogEntry, error)
+	SaveState(state State) error
+	// Append persists entries following the last stored entry
+	Append(entries ...*protocol.LogEntry) error
+	// Truncate removes entries starting from index
+	Truncate(from uint64) error
+	Close() error
+}
+
+// checkContinuity validates that entries have consecutive indexes following lastIndex
+func checkContinuity(lastIndex uint64, entries []*protocol.LogEntry) error {
+	for _, entry := range entries {
+		if entry.GetIndex() != lastIndex+1 {
+			return fmt.Errorf("%w: index %d after %d", ErrIndexGap, entry.GetIndex(), lastIndex)
+		}
+		lastIndex++
+	}
+	return nil
+}
+
+// MemoryStore keeps state in memory, it's useful for tests and replicas which rejoin the cluster with empty state
+type MemoryStore struct {
+	mux     sync.Mutex
+	state   State
+	entries []*protocol.LogEntry
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (ms *MemoryStore) Load() (State, []*protocol.LogEntry, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	return ms.state, append([]*protocol.LogEntry(nil), ms.entries...), nil
+}
+
+func (ms *MemoryStore) SaveState(state State) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	ms.state = state
+	return nil
+}
+
+func (ms *MemoryStore) Append(entries ...*protocol.LogEntry) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	if err := checkContinuity(uint64(len(ms.entries)), entries); err != nil {
+		return err
+	}
+	ms.entries = append(ms.entries, entries...)
+	return nil
+}
+
+func (ms *MemoryStore) Truncate(from uint64) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	if from == 0 {
+		from = 1
+	}
+	if from <= uint64(len(ms.entries)) {
+		ms.entries = ms.entries[:from-1]
+	}
+	return nil
+}
+
+func (ms *MemoryStore) Close() error {
+	return nil
+}
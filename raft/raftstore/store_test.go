@@ -0,0 +1,194 @@
+package raftstore
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/einherij/enterprise/raft/raftgrpc/protocol"
+)
+
+type StoreSuite struct {
+	suite.Suite
+
+	dir string
+}
+
+func TestStore(t *testing.T) {
+	suite.Run(t, new(StoreSuite))
+}
+
+func (s *StoreSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+}
+
+func entries(from, to uint64, term uint64) []*protocol.LogEntry {
+	var result []*protocol.LogEntry
+	for index := from; index <= to; index++ {
+		result = append(result, &protocol.LogEntry{
+			Index:       index,
+			Term:        term,
+			CommandName: "set",
+			SharedData:  []byte(strconv.FormatUint(index, 10)),
+		})
+	}
+	return result
+}
+
+func (s *StoreSuite) openFileStore() *FileStore {
+	store, err := OpenFileStore(s.dir, WithSegmentSize(100))
+	s.Require().NoError(err)
+	return store
+}
+
+func (s *StoreSuite) checkLoad(store Store, expectedState State, expectedEntries []*protocol.LogEntry) {
+	state, loaded, err := store.Load()
+	s.Require().NoError(err)
+	s.Equal(expectedState, state)
+	s.Require().Len(loaded, len(expectedEntries))
+	for i := range expectedEntries {
+		s.Equal(expectedEntries[i].GetIndex(), loaded[i].GetIndex())
+		s.Equal(expectedEntries[i].GetTerm(), loaded[i].GetTerm())
+		s.Equal(expectedEntries[i].GetSharedData(), loaded[i].GetSharedData())
+	}
+}
+
+// checkStore runs the same scenario for every implementation
+func (s *StoreSuite) checkStore(store Store) {
+	s.checkLoad(store, State{}, nil)
+
+	state := State{Term: 3, VotedFor: "127.0.0.1:4141"}
+	s.NoError(store.SaveState(state))
+	s.NoError(store.Append(entries(1, 10, 1)...))
+	s.NoError(store.Append(entries(11, 12, 2)...))
+	s.ErrorIs(store.Append(entries(14, 14, 2)...), ErrIndexGap)
+
+	s.NoError(store.Truncate(5))
+	s.NoError(store.Truncate(20))
+	s.NoError(store.Append(entries(5, 6, 3)...))
+	s.checkLoad(store, state, append(entries(1, 4, 1), entries(5, 6, 3)...))
+
+	s.NoError(store.Truncate(1))
+	s.checkLoad(store, state, nil)
+	s.NoError(store.Append(entries(1, 1, 3)...))
+	s.checkLoad(store, state, entries(1, 1, 3))
+}
+
+func (s *StoreSuite) TestMemoryStore() {
+	s.checkStore(NewMemoryStore())
+}
+
+func (s *StoreSuite) TestFileStore() {
+	store := s.openFileStore()
+	s.checkStore(store)
+	s.NoError(store.Close())
+}
+
+func (s *StoreSuite) TestFileStoreReopen() {
+	store := s.openFileStore()
+	state := State{Term: 2, VotedFor: "b"}
+	s.NoError(store.SaveState(state))
+	s.NoError(store.Append(entries(1, 20, 1)...))
+	for index := uint64(21); index <= 30; index++ {
+		s.NoError(store.Append(entries(index, index, 2)...))
+	}
+	s.NoError(store.Close())
+
+	segments, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	s.Require().NoError(err)
+	s.Greater(len(segments), 2)
+
+	store = s.openFileStore()
+	s.checkLoad(store, state, append(entries(1, 20, 1), entries(21, 30, 2)...))
+	s.NoError(store.Truncate(25))
+	s.NoError(store.Append(entries(25, 25, 3)...))
+	s.NoError(store.Close())
+
+	store = s.openFileStore()
+	s.checkLoad(store, state, append(append(entries(1, 20, 1), entries(21, 24, 2)...), entries(25, 25, 3)...))
+	s.NoError(store.Close())
+}
+
+func (s *StoreSuite) lastSegment() string {
+	segments, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	s.Require().NoError(err)
+	s.Require().NotEmpty(segments)
+	return segments[len(segments)-1]
+}
+
+func (s *StoreSuite) TestFileStoreTornWrite() {
+	store := s.openFileStore()
+	s.NoError(store.Append(entries(1, 3, 1)...))
+	s.NoError(store.Close())
+
+	// interrupted write leaves a part of the record
+	record, err := encodeRecord(entries(4, 4, 1)[0])
+	s.Require().NoError(err)
+	file, err := os.OpenFile(s.lastSegment(), os.O_WRONLY|os.O_APPEND, 0o644)
+	s.Require().NoError(err)
+	_, err = file.Write(record[:len(record)-2])
+	s.Require().NoError(err)
+	s.Require().NoError(file.Close())
+
+	store = s.openFileStore()
+	s.checkLoad(store, State{}, entries(1, 3, 1))
+	s.NoError(store.Append(entries(4, 4, 1)...))
+	s.NoError(store.Close())
+
+	store = s.openFileStore()
+	s.checkLoad(store, State{}, entries(1, 4, 1))
+	s.NoError(store.Close())
+}
+
+func (s *StoreSuite) TestFileStoreCorruption() {
+	store := s.openFileStore()
+	s.NoError(store.Append(entries(1, 2, 1)...))
+	s.NoError(store.Close())
+
+	// damaged checksum of the last record is treated as torn write
+	path := s.lastSegment()
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	data[len(data)-1] ^= 0xff
+	s.Require().NoError(os.WriteFile(path, data, 0o644))
+
+	store = s.openFileStore()
+	s.checkLoad(store, State{}, entries(1, 1, 1))
+	s.NoError(store.Append(entries(2, 20, 1)...))
+	s.NoError(store.Append(entries(21, 21, 1)...))
+	s.NoError(store.Close())
+
+	// damaged record in the middle of the log can't be recovered
+	segments, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	s.Require().NoError(err)
+	s.Require().Greater(len(segments), 1)
+	data, err = os.ReadFile(segments[0])
+	s.Require().NoError(err)
+	data[recordHeader] ^= 0xff
+	s.Require().NoError(os.WriteFile(segments[0], data, 0o644))
+	_, err = OpenFileStore(s.dir)
+	s.ErrorIs(err, ErrCorrupted)
+
+	// damaged record followed by valid records in the last segment isn't a torn write
+	s.Require().NoError(os.RemoveAll(s.dir))
+	store = s.openFileStore()
+	s.NoError(store.Append(entries(1, 3, 1)...))
+	s.NoError(store.Close())
+	path = s.lastSegment()
+	data, err = os.ReadFile(path)
+	s.Require().NoError(err)
+	data[recordHeader] ^= 0xff
+	s.Require().NoError(os.WriteFile(path, data, 0o644))
+	_, err = OpenFileStore(s.dir)
+	s.ErrorIs(err, ErrCorrupted)
+	data, err = os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Len(data, int(store.segments[0].size()), "segment isn't truncated")
+
+	s.Require().NoError(os.WriteFile(filepath.Join(s.dir, stateFileName), []byte("broken state"), 0o644))
+	_, err = OpenFileStore(s.dir)
+	s.ErrorIs(err, ErrCorrupted)
+}
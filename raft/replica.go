@@ -2,18 +2,20 @@ package raft
 
 import (
 	"context"
-	"crypto/tls"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/rand"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/sirupsen/logrus"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	"github.com/einherij/enterprise/logging"
 	"github.com/einherij/enterprise/raft/raftgrpc"
 	"github.com/einherij/enterprise/raft/raftgrpc/protocol"
 	"github.com/einherij/enterprise/raft/raftstorage"
@@ -22,8 +24,40 @@ import (
 var _ = ReplicaInterface(&Replica{})
 
 type ReplicaInterface interface {
+	LeadershipObserver
 	RegisterCommand(commandName string, command raftgrpc.Command)
-	ExecuteCommand(commandName string, sharedData []byte) error
+	ExecuteCommand(ctx context.Context, commandName string, sharedData []byte) error
+	// Leader returns address of the current leader or empty string while elections are in progress
+	Leader() string
+}
+
+type LeadershipObserver interface {
+	IsLeader() bool
+	// LeadershipChanges subscribes to changes of the leader until returned function is called
+	LeadershipChanges() (<-chan raftgrpc.Leadership, func())
+}
+
+var (
+	// ErrNotLeader is matched by NotLeaderError
+	ErrNotLeader = raftgrpc.ErrNotLeader
+	ErrNoLeader  = errors.New("no leader is elected")
+)
+
+// NotLeaderError is returned by operations which are allowed only on the leader
+type NotLeaderError struct {
+	// Leader is empty while elections are in progress
+	Leader string
+}
+
+func (e *NotLeaderError) Error() string {
+	if e.Leader == "" {
+		return "replica is not the leader, leader is unknown"
+	}
+	return fmt.Sprintf("replica is not the leader, leader is %s", e.Leader)
+}
+
+func (e *NotLeaderError) Is(target error) bool {
+	return target == ErrNotLeader
 }
 
 const (
@@ -38,16 +72,29 @@ const (
 
 	electionFrom = grpcMaxExecutionDuration * 3 // so it won't become candidate and will wait for append entries
 	electionTo   = grpcMaxExecutionDuration * 6 // enough time difference between candidates' elections
+
+	maxEntriesPerRequest = 100 // lagging followers catch up by batches
+	maxBatchesPerRound   = 4   // the rest of batches is sent in the next rounds, so replication doesn't delay heartbeats
+
+	// interval between attempts to forward command to the leader grows while leader isn't elected
+	forwardBackoffFrom = 50 * time.Millisecond
+	forwardBackoffTo   = time.Second
 )
 
 // time until follower becomes a candidate
-func electionTimeout() time.Duration {
-	return timeoutInRange(electionFrom, electionTo)
+func (r *Replica) electionTimeout() time.Duration {
+	return timeoutInRange(r.electionFrom, r.electionTo)
 }
 
 // time between heartbeats
-func appendEntriesTimeout() time.Duration {
-	return appendEntries
+func (r *Replica) appendEntriesTimeout() time.Duration {
+	return r.appendEntries
+}
+
+// deadline of a request to other replica, it's well below election timeout,
+// so unresponsive replica doesn't make the leader miss heartbeats
+func (r *Replica) rpcTimeout() time.Duration {
+	return r.electionFrom / 2
 }
 
 func timeoutInRange(min, max time.Duration) time.Duration {
@@ -58,244 +105,607 @@ func timeoutInRange(min, max time.Duration) time.Duration {
 	return min + randomTimeDifference
 }
 
-// Replica participates in elections, if it becomes a leader sends commands to follower servers
+// Replica participates in elections, if it becomes a leader replicates log of commands to follower servers
 type Replica struct {
-	log *logrus.Logger
+	log logging.Logger
 
 	server  *raftgrpc.ReplicaServer
 	storage raftstorage.Storage
+
+	appendEntries time.Duration
+	electionFrom  time.Duration
+	electionTo    time.Duration
+
+	peers *peers
+
+	// progress of followers' logs, used only by the leader
+	progress    map[string]*followerProgress
+	leaderSince time.Time
+	// replicated wakes up the leader to commit entries acknowledged by followers
+	replicated chan struct{}
+}
+
+// followerProgress is changed by replication to the follower and read by the leader loop
+type followerProgress struct {
+	mux         sync.Mutex
+	nextIndex   uint64
+	matchIndex  uint64
+	lastContact time.Time
+	// inFlight is set while replication to the follower is running
+	inFlight bool
+}
+
+// start returns false if replication to the follower is already running
+func (p *followerProgress) start() bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.inFlight {
+		return false
+	}
+	p.inFlight = true
+	return true
+}
+
+func (p *followerProgress) finish() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.inFlight = false
 }
 
-func NewReplica(storage raftstorage.Storage, server *raftgrpc.ReplicaServer, logger *logrus.Logger) *Replica {
+func (p *followerProgress) next() uint64 {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.nextIndex
+}
+
+func (p *followerProgress) setNext(nextIndex uint64) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.nextIndex = nextIndex
+}
+
+func (p *followerProgress) match() uint64 {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.matchIndex
+}
+
+func (p *followerProgress) lagging(lastLogIndex uint64) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.nextIndex <= lastLogIndex
+}
+
+func (p *followerProgress) contact() time.Time {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.lastContact
+}
+
+func (p *followerProgress) contacted(at time.Time) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.lastContact = at
+}
+
+func (p *followerProgress) matched(matchIndex uint64) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.matchIndex = matchIndex
+	p.nextIndex = matchIndex + 1
+}
+
+// stepBack moves next index back when follower's log doesn't match, hint is the index suggested by follower
+func (p *followerProgress) stepBack(hint uint64) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	nextIndex := hint + 1
+	if nextIndex >= p.nextIndex {
+		nextIndex = p.nextIndex - 1
+	}
+	if nextIndex < 1 {
+		nextIndex = 1
+	}
+	p.nextIndex = nextIndex
+}
+
+// ReplicaOption configures Replica
+type ReplicaOption func(r *Replica)
+
+// WithTimeouts sets interval between append entries requests of the leader
+// and range of follower's random election timeout
+func WithTimeouts(appendEntries, electionFrom, electionTo time.Duration) ReplicaOption {
+	return func(r *Replica) {
+		r.appendEntries = appendEntries
+		r.electionFrom = electionFrom
+		r.electionTo = electionTo
+	}
+}
+
+func NewReplica(storage raftstorage.Storage, server *raftgrpc.ReplicaServer, logger logging.Logger, opts ...ReplicaOption) *Replica {
 	r := &Replica{
-		log:     logger,
-		server:  server,
-		storage: storage,
+		log:           logger,
+		server:        server,
+		storage:       storage,
+		appendEntries: appendEntries,
+		electionFrom:  electionFrom,
+		electionTo:    electionTo,
+		progress:      make(map[string]*followerProgress),
+		replicated:    make(chan struct{}, 1),
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.peers = newPeers(r.appendEntries, r.electionFrom)
+	// followers which hear from the leader don't let other replicas start elections
+	server.SetLeaderLease(r.electionFrom)
 	return r
 }
 
 func (r *Replica) Run(ctx context.Context) {
-	electionTimer := time.NewTimer(electionTimeout())
+	go r.server.Run(ctx)
+	defer r.peers.close()
+
+	electionTimer := time.NewTimer(r.electionTimeout())
 	appendEntriesTimer := time.NewTimer(0)
 	<-appendEntriesTimer.C               // need empty timer
 	r.server.SetState(raftgrpc.Follower) // default state
 
+	var (
+		lastState  = raftgrpc.Follower
+		leaderTerm uint64
+	)
 mainLoop:
 	for {
-		switch r.server.GetState() {
+		state := r.server.GetState()
+		if state != lastState {
+			r.log.Debugf("%s state is changed to %v, term: %d", r.storage.GetMyAddress(), state, r.server.GetTerm())
+			if state == raftgrpc.Follower {
+				// stepped down after losing elections or observing newer term
+				resetTimer(electionTimer, r.electionTimeout())
+			}
+			lastState = state
+		}
+
+		switch state {
 		case raftgrpc.Follower:
-			// listen for coordinator command or election requests
-			// if there is no command change state to Candidate
-			// if there is leader command, then do it, and send done message to leader
-			// if there is election request change state to candidate and send vote to server, that requested
+			// listen for append entries of the leader or election requests
+			// if there is nothing until election timeout, check that replica can win elections and become a candidate
 			select {
 			case votedFor := <-r.server.IncomingElectionRequests():
-				r.log.Debugf("%s accepted election request from: %s, term: %d", r.storage.GetMyAddress(), votedFor, r.server.GetTerm())
+				r.log.Debugf("%s voted for %s, term: %d", r.storage.GetMyAddress(), votedFor, r.server.GetTerm())
 
-				electionTimer.Reset(electionTimeout())
+				resetTimer(electionTimer, r.electionTimeout())
 			case leaderAddress := <-r.server.IncomingHeartbeats():
 				r.log.Debugf("%s received heartbeat from %s, term: %d", r.storage.GetMyAddress(), leaderAddress, r.server.GetTerm())
 
-				electionTimer.Reset(electionTimeout())
+				resetTimer(electionTimer, r.electionTimeout())
 			case <-electionTimer.C:
+				r.server.ForgetLeader()
+				if !r.preVote() {
+					r.log.Debugf("%s pre-vote failed, term: %d", r.storage.GetMyAddress(), r.server.GetTerm())
+					electionTimer.Reset(r.electionTimeout())
+					continue mainLoop
+				}
 				r.server.SetState(raftgrpc.Candidate)
-				r.log.Debugf("%s state is changed to %v", r.storage.GetMyAddress(), r.server.GetState())
 			case <-ctx.Done():
 				return
 			}
 		case raftgrpc.Candidate:
-			// start elections timeout
-			// vote for myself, if I've started elections
-			// send election requests
-			var (
-				term      = r.server.NewTerm()
-				myAddress = r.storage.GetMyAddress()
-
-				started     = time.Now()
-				wg          sync.WaitGroup
-				votesAmount atomic.Int32
-			)
-			replicas, err := r.storage.GetReplicas()
+			// start new term voting for myself
+			// send election requests, become a leader if majority voted
+			started := time.Now()
+			term, err := r.server.NewTerm()
 			if err != nil {
-				r.log.Errorf("error getting replicas: %v", err)
+				r.log.Errorf("error starting new term: %v", err)
 				r.server.SetState(raftgrpc.Follower)
-				r.log.Debugf("%s state is changed to %v", r.storage.GetMyAddress(), r.server.GetState())
-				electionTimer.Reset(electionTimeout())
 				continue mainLoop
 			}
-
-			votesAmount.Store(1) // self vote
-			for _, replica := range replicas {
-				replica := replica
-				if replica == myAddress {
-					continue
-				}
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					if voted := r.sendElectionRequest(replica, myAddress, term); voted {
-						votesAmount.Add(1) // replica vote
-					}
-				}()
+			lastLogIndex, lastLogTerm := r.server.LastLog()
+			votes, replicasCount, err := r.requestVotes(&protocol.ElectionRequest{
+				Address:      r.storage.GetMyAddress(),
+				Term:         term,
+				LastLogIndex: lastLogIndex,
+				LastLogTerm:  lastLogTerm,
+			})
+			if err != nil {
+				r.log.Errorf("error getting replicas: %v", err)
+				r.server.SetState(raftgrpc.Follower)
+				continue mainLoop
 			}
-			wg.Wait()
 			r.log.Debugf("%s sending election requests duration: %v", r.storage.GetMyAddress(), time.Now().Sub(started))
-			r.log.Debugf("%s voted %d followers from %d", r.storage.GetMyAddress(), votesAmount.Load(), len(replicas))
-			if float32(votesAmount.Load()) > float32(len(replicas))/2. {
-				r.server.SetState(raftgrpc.Leader)
-				appendEntriesTimer.Reset(0)
-			} else {
+			r.log.Debugf("%s voted %d followers from %d", r.storage.GetMyAddress(), votes, replicasCount)
+			if isMajority(votes, replicasCount) && r.server.Promote(term) {
+				leaderTerm = term
+				r.leaderSince = time.Now()
+				r.resetProgress()
+				// entries of previous terms are committed with the first entry of the new term
+				if _, _, err = r.server.Propose("", "", nil); err != nil {
+					r.log.Errorf("error appending entry of the new term: %v", err)
+				}
+				resetTimer(appendEntriesTimer, 0)
+			} else if r.server.GetState() == raftgrpc.Candidate {
 				r.server.SetState(raftgrpc.Follower)
-				electionTimer.Reset(electionTimeout())
 			}
-			r.log.Debugf("%s state is changed to %v", r.storage.GetMyAddress(), r.server.GetState())
 		case raftgrpc.Leader:
-			// send keep alive or send commands to followers, wait for respond
-			// perform command on current node if more than 50% of followers did command
+			// send new entries or keep alive to followers, replication to every follower runs on its own,
+			// so slow follower doesn't delay heartbeats to others
+			// commit entries which are replicated on more than 50% of replicas
+			var heartbeat bool
 			select {
 			case <-appendEntriesTimer.C:
-				var (
-					started             = time.Now()
-					myAddress           = r.storage.GetMyAddress()
-					wg                  sync.WaitGroup
-					heartbeatsResponded atomic.Int32
-				)
-				replicas, err := r.storage.GetReplicas()
-				if err != nil {
-					r.server.SetState(raftgrpc.Follower)
-					electionTimer.Reset(electionTimeout())
-					continue mainLoop
-				}
+				heartbeat = true
+				appendEntriesTimer.Reset(r.appendEntriesTimeout())
+			case <-r.server.IncomingProposals():
+				heartbeat = true
+			case <-r.replicated:
+			case <-ctx.Done():
+				return
+			}
+			if r.server.GetState() != raftgrpc.Leader {
+				continue mainLoop // stepped down observing newer term
+			}
+			myAddress := r.storage.GetMyAddress()
+			replicas, err := r.storage.GetReplicas()
+			if err != nil {
+				r.log.Errorf("error getting replicas: %v", err)
+				r.server.SetState(raftgrpc.Follower)
+				continue mainLoop
+			}
 
-				heartbeatsResponded.Store(1) // self heartbeat
-				for _, follower := range replicas {
-					follower := follower
-					if follower == myAddress {
-						continue
-					}
-					wg.Add(1)
-					go func() {
-						defer wg.Done()
-						if ok := r.sendHeartBeat(follower, r.storage.GetMyAddress(), r.server.GetTerm()); ok {
-							heartbeatsResponded.Add(1) // replica vote
-						}
-					}()
+			lastLogIndex := r.server.LastLogIndex()
+			for _, follower := range replicas {
+				follower := follower
+				if follower == myAddress {
+					continue
+				}
+				progress := r.followerProgress(follower)
+				if !heartbeat && !progress.lagging(lastLogIndex) {
+					continue
 				}
-				wg.Wait()
-				r.log.Debugf("%s sending heartbeats duration: %v", r.storage.GetMyAddress(), time.Now().Sub(started))
-				r.log.Debugf("%s responded %d heartbeats", r.storage.GetMyAddress(), heartbeatsResponded.Load())
-				if float32(heartbeatsResponded.Load()) <= float32(len(replicas))/2. {
+				if !progress.start() {
+					continue // previous replication is still running
+				}
+				go func() {
+					defer progress.finish()
+					if ok := r.replicateTo(ctx, follower, progress, myAddress, leaderTerm); ok {
+						select {
+						case r.replicated <- struct{}{}:
+						default:
+						}
+					}
+				}()
+			}
+			if !r.hasQuorum(replicas) {
+				r.log.Debugf("%s lost contact with majority of replicas, term: %d", myAddress, leaderTerm)
+				if r.server.GetState() == raftgrpc.Leader {
 					r.server.SetState(raftgrpc.Follower)
-					r.log.Debugf(r.storage.GetMyAddress(), "state is changed to", r.server.GetState())
-					electionTimer.Reset(electionTimeout())
 				}
-
-				appendEntriesTimer.Reset(appendEntriesTimeout())
-			case <-ctx.Done():
-				return
+				continue mainLoop
 			}
+			r.server.Commit(r.majorityMatchIndex(replicas))
 		}
 	}
 }
 
-func (r *Replica) RegisterCommand(commandName string, command raftgrpc.Command) {
-	r.server.AddCommand(commandName, command)
+// hasQuorum checks that the majority of replicas responded to the leader within election timeout,
+// otherwise other leader could be elected meanwhile
+func (r *Replica) hasQuorum(replicas []string) bool {
+	if time.Since(r.leaderSince) < r.electionFrom {
+		return true
+	}
+	var (
+		myAddress = r.storage.GetMyAddress()
+		contacted = int32(1) // self
+	)
+	for _, replica := range replicas {
+		if replica == myAddress {
+			continue
+		}
+		if progress, ok := r.progress[replica]; ok && time.Since(progress.contact()) < r.electionFrom {
+			contacted++
+		}
+	}
+	return isMajority(contacted, len(replicas))
 }
 
-func (r *Replica) ExecuteCommand(commandName string, sharedData []byte) error {
-	if r.server.GetState() != raftgrpc.Leader {
-		return nil
+// preVote checks that replica can win elections without changing term,
+// replicas which hear from the leader or have more recent log entries don't vote
+func (r *Replica) preVote() bool {
+	lastLogIndex, lastLogTerm := r.server.LastLog()
+	votes, replicasCount, err := r.requestVotes(&protocol.ElectionRequest{
+		Address:      r.storage.GetMyAddress(),
+		Term:         r.server.GetTerm() + 1,
+		LastLogIndex: lastLogIndex,
+		LastLogTerm:  lastLogTerm,
+		PreVote:      true,
+	})
+	if err != nil {
+		r.log.Errorf("error getting replicas: %v", err)
+		return false
 	}
+	return isMajority(votes, replicasCount)
+}
+
+// requestVotes sends election request to other replicas, the replica votes for itself
+func (r *Replica) requestVotes(request *protocol.ElectionRequest) (votes int32, replicasCount int, err error) {
 	replicas, err := r.storage.GetReplicas()
 	if err != nil {
-		return fmt.Errorf("error getting replilcas: %w", err)
+		return 0, 0, err
 	}
+	var (
+		wg          sync.WaitGroup
+		votesAmount atomic.Int32
+	)
+	votesAmount.Store(1) // self vote
 	for _, replica := range replicas {
-		if ok := r.sendExecuteCommand(replica, commandName, sharedData); !ok {
-			return fmt.Errorf("%s replica %s didn't execute the command %s", r.storage.GetMyAddress(), replica, commandName)
+		replica := replica
+		if replica == request.GetAddress() {
+			continue
 		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if voted := r.sendElectionRequest(replica, request); voted {
+				votesAmount.Add(1) // replica vote
+			}
+		}()
 	}
-	return nil
+	wg.Wait()
+	return votesAmount.Load(), len(replicas), nil
 }
 
-func (r *Replica) sendExecuteCommand(toReplica, commandName string, sharedData []byte) (done bool) {
-	var err = grpcSingleCall(toReplica, func(ctx context.Context, client protocol.FollowerClient) error {
-		_, err := client.SendExecuteCommand(ctx, &protocol.Command{Name: commandName, SharedData: sharedData})
-		return err
-	})
+func isMajority(votes int32, replicasCount int) bool {
+	return float32(votes) > float32(replicasCount)/2.
+}
 
-	return err == nil
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
 }
 
-func (r *Replica) sendElectionRequest(toReplica, myAddress string, term uint64) (voted bool) {
-	err := grpcSingleCall(toReplica, func(ctx context.Context, client protocol.FollowerClient) error {
-		response, err := client.SendElectionRequest(ctx, &protocol.ElectionRequest{
-			Address: myAddress,
-			Term:    term,
-		})
-		voted = response.GetVote()
-		return err
-	})
-	if err != nil {
-		r.log.Errorf("error sending grpc single call: %v", err)
+func (r *Replica) resetProgress() {
+	r.progress = make(map[string]*followerProgress)
+}
+
+func (r *Replica) followerProgress(follower string) *followerProgress {
+	progress, ok := r.progress[follower]
+	if !ok {
+		progress = &followerProgress{nextIndex: r.server.LastLogIndex() + 1}
+		r.progress[follower] = progress
 	}
-	return voted
+	return progress
+}
+
+// majorityMatchIndex returns the highest log index stored on the majority of replicas
+func (r *Replica) majorityMatchIndex(replicas []string) uint64 {
+	var (
+		myAddress    = r.storage.GetMyAddress()
+		matchIndexes = make([]uint64, 0, len(replicas))
+	)
+	for _, replica := range replicas {
+		if replica == myAddress {
+			matchIndexes = append(matchIndexes, r.server.LastLogIndex())
+		} else if progress, ok := r.progress[replica]; ok {
+			matchIndexes = append(matchIndexes, progress.match())
+		} else {
+			matchIndexes = append(matchIndexes, 0)
+		}
+	}
+	if len(matchIndexes) == 0 {
+		return 0
+	}
+	sort.Slice(matchIndexes, func(i, j int) bool { return matchIndexes[i] > matchIndexes[j] })
+	return matchIndexes[len(matchIndexes)/2]
 }
 
-func (r *Replica) sendHeartBeat(toReplica, myAddress string, term uint64) (ok bool) {
-	var err = grpcSingleCall(toReplica, func(ctx context.Context, client protocol.FollowerClient) error {
-		response, err := client.SendHeartBeat(ctx, &protocol.HeartbeatRequest{
+// replicateTo sends batches of entries starting from follower's next index until its log matches leader's log,
+// lagging follower receives at most maxBatchesPerRound batches and catches up in the next rounds.
+// It returns true if follower responded.
+func (r *Replica) replicateTo(ctx context.Context, follower string, progress *followerProgress, myAddress string, term uint64) (ok bool) {
+	for batch := 0; batch < maxBatchesPerRound && ctx.Err() == nil; batch++ {
+		nextIndex := progress.next()
+		prevLogTerm, entries, found := r.server.Entries(nextIndex, maxEntriesPerRequest)
+		if !found {
+			progress.setNext(r.server.LastLogIndex() + 1)
+			continue
+		}
+		response, err := r.sendAppendEntries(ctx, follower, &protocol.AppendEntriesRequest{
 			LeaderAddress: myAddress,
 			Term:          term,
+			PrevLogIndex:  nextIndex - 1,
+			PrevLogTerm:   prevLogTerm,
+			Entries:       entries,
+			LeaderCommit:  r.server.CommitIndex(),
 		})
-		ok = response.GetOk()
-		return err
-	})
-	if err != nil {
-		r.log.Errorf("error sending grpc single call: %v", err)
+		if err != nil {
+			r.log.Errorf("error sending append entries to %s: %v", follower, err)
+			return ok
+		}
+		if response.GetTerm() > term {
+			if err = r.server.ObserveTerm(response.GetTerm()); err != nil {
+				r.log.Errorf("error observing term of %s: %v", follower, err)
+			}
+			return false
+		}
+		progress.contacted(time.Now())
+		ok = true
+		if !response.GetSuccess() {
+			// follower's log doesn't match, step back
+			progress.stepBack(response.GetMatchIndex())
+			continue
+		}
+		progress.matched(response.GetMatchIndex())
+		if response.GetMatchIndex() >= r.server.LastLogIndex() {
+			return true
+		}
 	}
 	return ok
 }
 
-type singleCallFunc func(ctx context.Context, client protocol.FollowerClient) error
+func (r *Replica) Leader() string {
+	return r.server.Leader()
+}
 
-func grpcSingleCall(toReplica string, call singleCallFunc) error {
-	client, conn, err := establishConnection(toReplica)
+func (r *Replica) IsLeader() bool {
+	return r.server.GetState() == raftgrpc.Leader
+}
+
+func (r *Replica) LeadershipChanges() (<-chan raftgrpc.Leadership, func()) {
+	return r.server.LeadershipChanges()
+}
+
+func (r *Replica) RegisterCommand(commandName string, command raftgrpc.Command) {
+	r.server.AddCommand(commandName, command)
+}
+
+// ExecuteCommand appends command to the replicated log and waits until it's committed and executed on the leader.
+// Followers forward command to the leader retrying until the context is done, if the context has no deadline
+// it's limited by command timeout. Command is also retried when its entry is overwritten after leader change.
+// Every attempt carries the same request id, so the command appended by a leader which failed to respond
+// is applied once. ErrNoLeader is returned if no leader is elected in time,
+// NotLeaderError with address of the leader is returned if the leader isn't reachable.
+func (r *Replica) ExecuteCommand(ctx context.Context, commandName string, sharedData []byte) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, grpcCommandTimeout)
+		defer cancel()
+	}
+	// subscribe before the first attempt, so the leader elected meanwhile is noticed
+	changes, unsubscribe := r.server.LeadershipChanges()
+	defer unsubscribe()
+
+	requestID, err := newRequestID()
 	if err != nil {
 		return err
 	}
-	defer func() {
-		_ = conn.Close()
-	}()
-	ctx, cancel := contextWithCommandTimeout()
-	defer cancel()
-	err = call(ctx, client)
-	if err != nil {
+	var (
+		myAddress = r.storage.GetMyAddress()
+		leader    string
+		lastErr   error
+		backoff   = forwardBackoffFrom
+	)
+	for {
+		err = r.server.Execute(ctx, requestID, commandName, sharedData)
+		if errors.Is(err, raftgrpc.ErrEntryOverwritten) {
+			r.log.Debugf("%s retrying command %s overwritten by another leader", myAddress, commandName)
+			lastErr = err
+		} else if !errors.Is(err, raftgrpc.ErrNotLeader) {
+			return err
+		}
+
+		if leader == "" || leader == myAddress {
+			leader = r.server.Leader()
+		}
+		if leader != "" && leader != myAddress {
+			var (
+				retry      bool
+				leaderHint string
+			)
+			retry, leaderHint, err = r.forwardCommand(ctx, leader, requestID, commandName, sharedData)
+			if !retry {
+				return err
+			}
+			r.log.Debugf("%s retrying command %s forwarded to %s: %v", myAddress, commandName, leader, err)
+			lastErr, leader = err, leaderHint
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case change := <-changes:
+			leader = change.Leader
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			if leader = r.server.Leader(); leader == "" {
+				return fmt.Errorf("%w: %v", ErrNoLeader, ctx.Err())
+			}
+			return fmt.Errorf("error forwarding command %s: %w: %v", commandName, &NotLeaderError{Leader: leader}, errors.Join(lastErr, ctx.Err()))
+		}
+		timer.Stop()
+		if backoff *= 2; backoff > forwardBackoffTo {
+			backoff = forwardBackoffTo
+		}
+	}
+}
+
+// forwardCommand executes command on the leader, it should be retried if the leader is changed or unavailable.
+// Unavailable leader might have appended the command before connection is lost, the retried command
+// has the same request id and isn't applied twice.
+func (r *Replica) forwardCommand(ctx context.Context, leader, requestID, commandName string, sharedData []byte) (retry bool, leaderHint string, err error) {
+	var response *protocol.ExecuteCommandResponse
+	err = r.grpcCall(ctx, leader, func(ctx context.Context, client protocol.FollowerClient) error {
+		response, err = client.ExecuteCommand(ctx, &protocol.ExecuteCommandRequest{
+			CommandName: commandName,
+			SharedData:  sharedData,
+			RequestId:   requestID,
+		})
 		return err
+	})
+	switch {
+	case status.Code(err) == codes.Unavailable || ctx.Err() != nil:
+		return true, "", err
+	case status.Code(err) == codes.NotFound:
+		return false, "", fmt.Errorf("error executing command %s on the leader %s: %w", commandName, leader, raftgrpc.ErrUnknownCommand)
+	case err != nil:
+		return false, "", fmt.Errorf("error executing command %s on the leader %s: %w", commandName, leader, err)
+	}
+	if response.GetNotLeader() {
+		return true, response.GetLeaderAddress(), &NotLeaderError{Leader: response.GetLeaderAddress()}
 	}
-	return nil
+	return false, "", nil
 }
 
-func establishConnection(serverAddress string) (protocol.FollowerClient, *grpc.ClientConn, error) {
-	const externalServer = false
-	// use tls credentials for external grpc server
-	var transportCreds credentials.TransportCredentials
-	if externalServer {
-		transportCreds = credentials.NewTLS(&tls.Config{})
-	} else {
-		transportCreds = insecure.NewCredentials()
+func newRequestID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := cryptorand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating request id: %w", err)
 	}
+	return hex.EncodeToString(id), nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), grpcConnectTimeout)
-	defer cancel()
-	conn, err := grpc.DialContext(ctx, serverAddress, grpc.WithTransportCredentials(transportCreds))
+func (r *Replica) sendAppendEntries(ctx context.Context, toReplica string, request *protocol.AppendEntriesRequest) (response *protocol.AppendEntriesResponse, err error) {
+	err = r.rpcCall(ctx, toReplica, func(ctx context.Context, client protocol.FollowerClient) error {
+		response, err = client.AppendEntries(ctx, request)
+		return err
+	})
+	return response, err
+}
+
+func (r *Replica) sendElectionRequest(toReplica string, request *protocol.ElectionRequest) (voted bool) {
+	err := r.rpcCall(context.Background(), toReplica, func(ctx context.Context, client protocol.FollowerClient) error {
+		response, err := client.SendElectionRequest(ctx, request)
+		if err != nil {
+			return err
+		}
+		voted = response.GetVote()
+		return r.server.ObserveTerm(response.GetTerm())
+	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("cannot connect to replica at %q: %+v", serverAddress, err)
+		r.log.Errorf("error sending election request to %s: %v", toReplica, err)
 	}
-	return protocol.NewFollowerClient(conn), conn, nil
+	return voted
+}
+
+type singleCallFunc func(ctx context.Context, client protocol.FollowerClient) error
+
+// rpcCall limits the call by rpc timeout
+func (r *Replica) rpcCall(ctx context.Context, toReplica string, call singleCallFunc) error {
+	ctx, cancel := context.WithTimeout(ctx, r.rpcTimeout())
+	defer cancel()
+	return r.grpcCall(ctx, toReplica, call)
 }
 
-func contextWithCommandTimeout() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), grpcCommandTimeout)
+// grpcCall uses connection to the replica which is kept between calls
+func (r *Replica) grpcCall(ctx context.Context, toReplica string, call singleCallFunc) error {
+	client, err := r.peers.client(toReplica)
+	if err != nil {
+		return err
+	}
+	return call(ctx, client)
 }
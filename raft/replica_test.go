@@ -1,70 +1,371 @@
 package raft
 
-//import (
-//	"context"
-//	"fmt"
-//	"strconv"
-//	"testing"
-//	"time"
-//
-//	"github.com/sirupsen/logrus"
-//	"github.com/stretchr/testify/assert"
-//
-//	"github.com/einherij/enterprise/db"
-//	"github.com/einherij/enterprise/raft/raftgrpc"
-//	"github.com/einherij/enterprise/raft/raftgrpc/protocol"
-//	"github.com/einherij/enterprise/raft/raftstorage"
-//)
-//
-//func Test_Replica(t *testing.T) {
-//	a := assert.New(t)
-//
-//	redisClient, err := db.NewRedisClient(db.RedisConfig{
-//		Host: "localhost",
-//		Port: 6379,
-//	})
-//	a.NoError(err)
-//
-//	for i := 1; i <= 5; i++ {
-//		servicePort := "414" + strconv.Itoa(i)
-//
-//		replicasStorage := raftstorage.NewReplicaStorage("localhost:"+servicePort,
-//			"raft",
-//			redisClient)
-//		ctx, cancel := context.WithCancel(context.Background())
-//		go replicasStorage.Run(ctx)
-//
-//		srv := raftgrpc.NewReplicaServer(replicasStorage)
-//
-//		grpcConfig := grpcserver.GRPCServerConfig{Port: servicePort}
-//		grpcSrv, err := grpcserver.New(grpcConfig)
-//		a.NoError(err)
-//		grpcSrv.RegisterService(&protocol.Follower_ServiceDesc, protocol.FollowerServer(srv))
-//		go grpcSrv.Run(ctx)
-//
-//		log := logrus.New()
-//		log.Level = logrus.DebugLevel
-//		r := NewReplica(replicasStorage, srv, log)
-//
-//		r.RegisterCommand("test_command", func(ctx context.Context, myAddress string, myState raftgrpc.State, replicaCount int) error {
-//			fmt.Println(myState, myAddress, "task started", replicaCount)
-//			<-time.After(electionTimeout())
-//			fmt.Println(myState, myAddress, "task executed", replicaCount)
-//			return nil
-//		})
-//
-//		r.Run(ctx)
-//
-//		go func() {
-//			<-time.After(20 * time.Second)
-//			a.NoError(r.ExecuteCommand("test_command"))
-//		}()
-//
-//		go func() {
-//			<-time.After(120 * time.Second)
-//			cancel()
-//		}()
-//	}
-//
-//	<-time.After(70 * time.Second)
-//}
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+
+	"github.com/einherij/enterprise"
+	"github.com/einherij/enterprise/raft/raftgrpc"
+	"github.com/einherij/enterprise/raft/raftgrpc/protocol"
+	"github.com/einherij/enterprise/raft/raftstorage"
+	"github.com/einherij/enterprise/raft/raftstore"
+)
+
+const (
+	testAppendEntries = 20 * time.Millisecond
+	testElectionFrom  = 150 * time.Millisecond
+	testElectionTo    = 300 * time.Millisecond
+	testWaitFor       = 10 * time.Second
+)
+
+type ReplicaSuite struct {
+	suite.Suite
+
+	ctx       context.Context
+	addresses []string
+	replicas  []*testReplica
+}
+
+func TestReplica(t *testing.T) {
+	suite.Run(t, new(ReplicaSuite))
+}
+
+// testReplica is a replica with own grpc server which records executed commands
+type testReplica struct {
+	address  string
+	server   *raftgrpc.ReplicaServer
+	replica  *Replica
+	grpc     *grpc.Server
+	listener net.Listener
+	stopped  chan struct{}
+	cancel   context.CancelFunc
+
+	mux      sync.Mutex
+	executed []string
+}
+
+func (s *ReplicaSuite) SetupTest() {
+	s.ctx = context.Background()
+	var listeners []net.Listener
+	s.addresses = nil
+	s.replicas = nil
+	for i := 0; i < 3; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		s.Require().NoError(err)
+		listeners = append(listeners, listener)
+		s.addresses = append(s.addresses, listener.Addr().String())
+	}
+	for i, listener := range listeners {
+		s.replicas = append(s.replicas, s.startReplica(s.addresses[i], listener, raftstore.NewMemoryStore()))
+	}
+}
+
+func (s *ReplicaSuite) TearDownTest() {
+	for _, replica := range s.replicas {
+		s.stopReplica(replica)
+	}
+}
+
+func (s *ReplicaSuite) startReplica(address string, listener net.Listener, store raftstore.Store) *testReplica {
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	storage := raftstorage.NewDummyStorage(address, s.addresses...)
+	server, err := raftgrpc.NewReplicaServer(storage, raftgrpc.WithStore(store), raftgrpc.WithLogger(logger))
+	s.Require().NoError(err)
+	tr := &testReplica{
+		address:  address,
+		server:   server,
+		grpc:     grpc.NewServer(),
+		listener: listener,
+		stopped:  make(chan struct{}),
+	}
+	tr.replica = NewReplica(storage, tr.server, logger, WithTimeouts(testAppendEntries, testElectionFrom, testElectionTo))
+	tr.replica.RegisterCommand("append", func(ctx context.Context, myAddress string, myState raftgrpc.State, replicaCount int, sharedData []byte) error {
+		tr.mux.Lock()
+		defer tr.mux.Unlock()
+		tr.executed = append(tr.executed, string(sharedData))
+		return nil
+	})
+	protocol.RegisterFollowerServer(tr.grpc, tr.server)
+
+	var ctx context.Context
+	ctx, tr.cancel = context.WithCancel(context.Background())
+	go func() {
+		_ = tr.grpc.Serve(listener)
+	}()
+	go func() {
+		defer close(tr.stopped)
+		tr.replica.Run(ctx)
+	}()
+	return tr
+}
+
+func (s *ReplicaSuite) stopReplica(tr *testReplica) {
+	tr.cancel()
+	tr.grpc.Stop()
+	_ = tr.listener.Close() // server might not have started serving yet
+	<-tr.stopped
+}
+
+func (tr *testReplica) executedCommands() []string {
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+	return append([]string(nil), tr.executed...)
+}
+
+func (s *ReplicaSuite) waitLeader() *testReplica {
+	var leader *testReplica
+	s.Require().Eventually(func() bool {
+		for _, tr := range s.replicas {
+			if tr.server.GetState() == raftgrpc.Leader {
+				leader = tr
+				return true
+			}
+		}
+		return false
+	}, testWaitFor, testAppendEntries)
+	return leader
+}
+
+func (s *ReplicaSuite) waitExecuted(tr *testReplica, expected []string) {
+	s.Eventually(func() bool {
+		return len(tr.executedCommands()) == len(expected)
+	}, testWaitFor, testAppendEntries, tr.address)
+	s.Equal(expected, tr.executedCommands(), tr.address)
+}
+
+func (s *ReplicaSuite) TestReplicatedCommands() {
+	leader := s.waitLeader()
+
+	s.NoError(leader.replica.ExecuteCommand(s.ctx, "append", []byte("1")))
+	s.NoError(leader.replica.ExecuteCommand(s.ctx, "append", []byte("2")))
+	s.Equal([]string{"1", "2"}, leader.executedCommands())
+	for _, tr := range s.replicas {
+		s.waitExecuted(tr, []string{"1", "2"})
+	}
+
+	s.ErrorIs(leader.replica.ExecuteCommand(s.ctx, "unknown", nil), raftgrpc.ErrUnknownCommand)
+}
+
+func (s *ReplicaSuite) TestLaggingFollowerCatchesUp() {
+	leader := s.waitLeader()
+	s.NoError(leader.replica.ExecuteCommand(s.ctx, "append", []byte("1")))
+
+	var follower int
+	for i, tr := range s.replicas {
+		if tr != leader {
+			follower = i
+			break
+		}
+	}
+	s.stopReplica(s.replicas[follower])
+
+	// the leader and the other follower are majority
+	s.NoError(leader.replica.ExecuteCommand(s.ctx, "append", []byte("2")))
+	s.NoError(leader.replica.ExecuteCommand(s.ctx, "append", []byte("3")))
+
+	// rejoined follower has empty log and receives all entries from the leader
+	listener, err := net.Listen("tcp", s.replicas[follower].address)
+	s.Require().NoError(err)
+	s.replicas[follower] = s.startReplica(s.replicas[follower].address, listener, raftstore.NewMemoryStore())
+	for _, tr := range s.replicas {
+		s.waitExecuted(tr, []string{"1", "2", "3"})
+	}
+}
+
+func (s *ReplicaSuite) TestRestartWithFileStore() {
+	var (
+		dir       = s.T().TempDir()
+		restarted = len(s.replicas) - 1
+		address   = s.replicas[restarted].address
+	)
+	s.stopReplica(s.replicas[restarted])
+	listener, err := net.Listen("tcp", address)
+	s.Require().NoError(err)
+	store, err := raftstore.OpenFileStore(dir)
+	s.Require().NoError(err)
+	s.replicas[restarted] = s.startReplica(address, listener, store)
+
+	leader := s.waitLeader()
+	s.NoError(leader.replica.ExecuteCommand(s.ctx, "append", []byte("1")))
+	s.NoError(leader.replica.ExecuteCommand(s.ctx, "append", []byte("2")))
+	s.waitExecuted(s.replicas[restarted], []string{"1", "2"})
+	term := s.replicas[restarted].server.GetTerm()
+	s.stopReplica(s.replicas[restarted])
+	s.NoError(store.Close())
+
+	// restarted replica has the log and term on disk and doesn't wait for leader to send them
+	store, err = raftstore.OpenFileStore(dir)
+	s.Require().NoError(err)
+	state, entries, err := store.Load()
+	s.Require().NoError(err)
+	s.GreaterOrEqual(state.Term, term)
+	s.GreaterOrEqual(len(entries), 2)
+
+	listener, err = net.Listen("tcp", address)
+	s.Require().NoError(err)
+	s.replicas[restarted] = s.startReplica(address, listener, store)
+	s.GreaterOrEqual(s.replicas[restarted].server.GetTerm(), term)
+	s.GreaterOrEqual(s.replicas[restarted].server.LastLogIndex(), uint64(2))
+
+	// committed entries are applied again after restart
+	leader = s.waitLeader()
+	s.NoError(leader.replica.ExecuteCommand(s.ctx, "append", []byte("3")))
+	s.waitExecuted(s.replicas[restarted], []string{"1", "2", "3"})
+	s.stopReplica(s.replicas[restarted])
+	s.NoError(store.Close())
+}
+
+func (s *ReplicaSuite) TestPartitionedFollowerDoesNotDisrupt() {
+	leader := s.waitLeader()
+	term := leader.server.GetTerm()
+	var partitioned *testReplica
+	for _, tr := range s.replicas {
+		if tr != leader {
+			partitioned = tr
+			break
+		}
+	}
+
+	// partitioned follower doesn't receive append entries, its pre-votes are rejected by replicas hearing from the leader
+	partitioned.grpc.Stop()
+	time.Sleep(5 * testElectionTo)
+	s.Equal(raftgrpc.Leader, leader.server.GetState())
+	s.Equal(term, leader.server.GetTerm())
+	s.Equal(term, partitioned.server.GetTerm())
+
+	listener, err := net.Listen("tcp", partitioned.address)
+	s.Require().NoError(err)
+	partitioned.grpc = grpc.NewServer()
+	partitioned.listener = listener
+	protocol.RegisterFollowerServer(partitioned.grpc, partitioned.server)
+	go func() {
+		_ = partitioned.grpc.Serve(listener)
+	}()
+
+	s.NoError(leader.replica.ExecuteCommand(s.ctx, "append", []byte("1")))
+	s.waitExecuted(partitioned, []string{"1"})
+	s.Equal(term, leader.server.GetTerm())
+}
+
+func (s *ReplicaSuite) TestHangingFollowerDoesNotDelayHeartbeats() {
+	leader := s.waitLeader()
+	term := leader.server.GetTerm()
+	var hanging *testReplica
+	for _, tr := range s.replicas {
+		if tr != leader {
+			hanging = tr
+			break
+		}
+	}
+
+	// hanging follower accepts connections, but never responds
+	hanging.grpc.Stop()
+	listener, err := net.Listen("tcp", hanging.address)
+	s.Require().NoError(err)
+	hanging.listener = listener
+	hanging.grpc = grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	protocol.RegisterFollowerServer(hanging.grpc, hanging.server)
+	go func() {
+		_ = hanging.grpc.Serve(listener)
+	}()
+
+	time.Sleep(5 * testElectionTo)
+	s.Equal(raftgrpc.Leader, leader.server.GetState())
+	for _, tr := range s.replicas {
+		if tr != hanging {
+			s.Equal(term, tr.server.GetTerm())
+		}
+	}
+	s.NoError(leader.replica.ExecuteCommand(s.ctx, "append", []byte("1")))
+}
+
+func (s *ReplicaSuite) TestLeadership() {
+	leader := s.waitLeader()
+	s.True(leader.replica.IsLeader())
+	for _, tr := range s.replicas {
+		s.Eventually(func() bool {
+			return tr.replica.Leader() == leader.address
+		}, testWaitFor, testAppendEntries)
+		if tr == leader {
+			continue
+		}
+		s.False(tr.replica.IsLeader())
+	}
+
+	changes, unsubscribe := leader.replica.LeadershipChanges()
+	defer unsubscribe()
+	var (
+		started = make(chan struct{}, 1)
+		stopped = make(chan struct{}, 1)
+		runner  = NewLeaderRunner("leader_job", leader.replica, enterprise.NewRunner("job", func(ctx context.Context) {
+			started <- struct{}{}
+			<-ctx.Done()
+			stopped <- struct{}{}
+		}))
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+	go runner.Run(ctx)
+	s.Eventually(func() bool { return len(started) == 1 }, testWaitFor, testAppendEntries)
+
+	// isolated leader loses majority and steps down
+	leader.grpc.Stop()
+	for _, tr := range s.replicas {
+		if tr != leader {
+			s.stopReplica(tr)
+		}
+	}
+	s.Eventually(func() bool { return len(stopped) == 1 }, testWaitFor, testAppendEntries)
+	s.False(leader.replica.IsLeader())
+	change := <-changes
+	s.False(change.IsLeader)
+}
+
+func (s *ReplicaSuite) TestForwardToLeader() {
+	leader := s.waitLeader()
+	var followers []*testReplica
+	for _, tr := range s.replicas {
+		if tr != leader {
+			followers = append(followers, tr)
+		}
+	}
+	s.Eventually(func() bool {
+		return followers[0].replica.Leader() == leader.address
+	}, testWaitFor, testAppendEntries)
+
+	s.NoError(followers[0].replica.ExecuteCommand(s.ctx, "append", []byte("1")))
+	s.ErrorIs(followers[0].replica.ExecuteCommand(s.ctx, "unknown", nil), raftgrpc.ErrUnknownCommand)
+	for _, tr := range s.replicas {
+		s.waitExecuted(tr, []string{"1"})
+	}
+
+	// command is retried until the new leader is elected
+	s.stopReplica(leader)
+	ctx, cancel := context.WithTimeout(s.ctx, testWaitFor)
+	defer cancel()
+	s.NoError(followers[0].replica.ExecuteCommand(ctx, "append", []byte("2")))
+	for _, tr := range followers {
+		s.waitExecuted(tr, []string{"1", "2"})
+	}
+
+	// the last replica can't be elected without majority
+	s.stopReplica(followers[1])
+	ctx, cancel = context.WithTimeout(s.ctx, 5*testElectionTo)
+	defer cancel()
+	s.Eventually(func() bool {
+		return followers[0].replica.Leader() == ""
+	}, testWaitFor, testAppendEntries)
+	s.ErrorIs(followers[0].replica.ExecuteCommand(ctx, "append", []byte("3")), ErrNoLeader)
+}
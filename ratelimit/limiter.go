@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit allows Rate requests per Period with bursts up to Burst requests
+type Limit struct {
+	Rate   int           `mapstructure:"rate" validate:"min=0"`
+	Period time.Duration `mapstructure:"period" default:"1s"`
+	// Burst is bucket capacity, Rate is used by default
+	Burst int `mapstructure:"burst" validate:"min=0"`
+}
+
+// IsZero is true for not configured limit which doesn't restrict requests
+func (l Limit) IsZero() bool {
+	return l.Rate <= 0
+}
+
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Rate)
+}
+
+// perSecond returns refill rate of bucket
+func (l Limit) perSecond() float64 {
+	period := l.Period
+	if period <= 0 {
+		period = time.Second
+	}
+	return float64(l.Rate) / period.Seconds()
+}
+
+// Result of taking a token from bucket
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is time until bucket is full
+	ResetAfter time.Duration
+	// RetryAfter is time until the next token for rejected request
+	RetryAfter time.Duration
+}
+
+// Limiter takes tokens from buckets identified by key
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// result calculates result from tokens left in bucket
+func result(limit Limit, allowed bool, tokens float64) Result {
+	var (
+		perSecond = limit.perSecond()
+		res       = Result{
+			Allowed:    allowed,
+			Limit:      int(limit.capacity()),
+			Remaining:  int(math.Floor(tokens)),
+			ResetAfter: secondsDuration((limit.capacity() - tokens) / perSecond),
+		}
+	)
+	if !allowed {
+		res.RetryAfter = secondsDuration((1 - tokens) / perSecond)
+	}
+	return res
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/einherij/enterprise/utils"
+)
+
+type LimiterSuite struct {
+	suite.Suite
+
+	ctx context.Context
+	now time.Time
+}
+
+func TestLimiter(t *testing.T) {
+	suite.Run(t, new(LimiterSuite))
+}
+
+func (s *LimiterSuite) SetupTest() {
+	s.ctx = context.Background()
+	s.now = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (s *LimiterSuite) localLimiter() *LocalLimiter {
+	limiter := NewLocalLimiter(time.Minute)
+	limiter.now = func() time.Time { return s.now }
+	return limiter
+}
+
+// checkBucket takes burst, checks rejection and refill after a half of period
+func (s *LimiterSuite) checkBucket(limiter Limiter, advance func(time.Duration)) {
+	limit := Limit{Rate: 2, Period: time.Second, Burst: 3}
+	for i := 2; i >= 0; i-- {
+		res, err := limiter.Allow(s.ctx, "client", limit)
+		s.Require().NoError(err)
+		s.True(res.Allowed)
+		s.Equal(3, res.Limit)
+		s.Equal(i, res.Remaining)
+	}
+	res, err := limiter.Allow(s.ctx, "client", limit)
+	s.Require().NoError(err)
+	s.False(res.Allowed)
+	s.Equal(500*time.Millisecond, res.RetryAfter.Round(time.Millisecond))
+	s.Equal(1500*time.Millisecond, res.ResetAfter.Round(time.Millisecond))
+
+	res, err = limiter.Allow(s.ctx, "other", limit)
+	s.Require().NoError(err)
+	s.True(res.Allowed)
+
+	advance(500 * time.Millisecond)
+	res, err = limiter.Allow(s.ctx, "client", limit)
+	s.Require().NoError(err)
+	s.True(res.Allowed)
+	s.Equal(0, res.Remaining)
+}
+
+func (s *LimiterSuite) TestLocalLimiter() {
+	limiter := s.localLimiter()
+	s.checkBucket(limiter, func(d time.Duration) { s.now = s.now.Add(d) })
+	s.Equal(2, limiter.buckets.Len())
+}
+
+func (s *LimiterSuite) TestRedisLimiter() {
+	server := miniredis.RunT(s.T())
+	server.SetTime(s.now)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	s.checkBucket(NewRedisLimiter(client), func(d time.Duration) {
+		s.now = s.now.Add(d)
+		server.SetTime(s.now)
+	})
+	s.True(server.Exists(redisKeyPrefix + "client"))
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, Limit) (Result, error) {
+	return Result{}, errors.New("redis is down")
+}
+
+func (s *LimiterSuite) TestMiddleware() {
+	cfg := Config{
+		Default: Limit{Rate: 100},
+		Routes:  map[string]Limit{"/login": {Rate: 1, Period: time.Minute}},
+	}
+	handler := Middleware("test", s.localLimiter(), cfg, ByIP(utils.DefaultIPResolver))(http.NotFoundHandler())
+	serve := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("/login", "203.0.113.1:1000")
+	s.Equal(http.StatusNotFound, w.Code)
+	s.Equal("1", w.Header().Get("RateLimit-Limit"))
+	s.Equal("0", w.Header().Get("RateLimit-Remaining"))
+	s.Equal("60", w.Header().Get("RateLimit-Reset"))
+
+	w = serve("/login", "203.0.113.1:1001")
+	s.Equal(http.StatusTooManyRequests, w.Code)
+	s.Equal("60", w.Header().Get("Retry-After"))
+	s.Equal("application/problem+json", w.Header().Get("Content-Type"))
+	s.Equal(1.0, testutil.ToFloat64(rejectedRequests.WithLabelValues("test", "/login")))
+
+	s.Equal(http.StatusNotFound, serve("/login", "203.0.113.2:1000").Code)
+	w = serve("/items", "203.0.113.1:1000")
+	s.Equal(http.StatusNotFound, w.Code)
+	s.Equal("100", w.Header().Get("RateLimit-Limit"))
+}
+
+func (s *LimiterSuite) TestMiddlewareFailOpen() {
+	handler := Middleware("failing", failingLimiter{}, Config{Default: Limit{Rate: 1}}, ByHeader("X-API-Key"))(http.NotFoundHandler())
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-API-Key", "key")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	s.Equal(http.StatusNotFound, w.Code)
+	s.Empty(w.Header().Get("RateLimit-Limit"))
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/einherij/enterprise/utils"
+)
+
+const (
+	defaultBucketTTL       = 10 * time.Minute
+	defaultCleanupInterval = time.Minute
+)
+
+type bucket struct {
+	mux    sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// LocalLimiter keeps token buckets in memory, buckets which are not used for ttl are evicted by Run
+type LocalLimiter struct {
+	mux     sync.Mutex
+	buckets *utils.ExpiringStorage[string, *bucket]
+	now     func() time.Time
+}
+
+var _ Limiter = (*LocalLimiter)(nil)
+
+// NewLocalLimiter creates limiter, ttl must be longer than time to refill the largest bucket
+func NewLocalLimiter(ttl time.Duration) *LocalLimiter {
+	if ttl <= 0 {
+		ttl = defaultBucketTTL
+	}
+	cleanupInterval := defaultCleanupInterval
+	if ttl < cleanupInterval {
+		cleanupInterval = ttl
+	}
+	return &LocalLimiter{
+		buckets: utils.NewExpiringStorage[string, *bucket](ttl, cleanupInterval),
+		now:     time.Now,
+	}
+}
+
+// Run evicts expired buckets
+func (l *LocalLimiter) Run(ctx context.Context) {
+	l.buckets.Run(ctx)
+}
+
+func (l *LocalLimiter) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	now := l.now()
+
+	l.mux.Lock()
+	b := l.buckets.Get(key)
+	if b == nil {
+		b = &bucket{tokens: limit.capacity(), last: now}
+	}
+	// prolong expiration on every access
+	l.buckets.Set(key, b)
+	l.mux.Unlock()
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * limit.perSecond()
+		if b.tokens > limit.capacity() {
+			b.tokens = limit.capacity()
+		}
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return result(limit, false, b.tokens), nil
+	}
+	b.tokens--
+	return result(limit, true, b.tokens), nil
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/einherij/enterprise/logging"
+	"github.com/einherij/enterprise/utils"
+	"github.com/einherij/enterprise/webtools"
+	"github.com/einherij/enterprise/webtools/middleware"
+)
+
+const defaultRoute = "default"
+
+var rejectedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "rate_limit_rejected_requests_total",
+	Help: "Number of requests rejected by rate limiter.",
+}, []string{"limiter", "route"})
+
+// KeyFunc returns key of bucket for request, false means that request isn't limited
+type KeyFunc func(r *http.Request) (string, bool)
+
+// ByIP limits requests by client IP
+func ByIP(resolver *utils.IPResolver) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		ip := resolver.ClientIP(r)
+		return ip, ip != ""
+	}
+}
+
+// ByHeader limits requests by header value e.g. API key, requests without header aren't limited
+func ByHeader(name string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		value := r.Header.Get(name)
+		return value, value != ""
+	}
+}
+
+type Config struct {
+	Default Limit `mapstructure:"default"`
+	// Routes override default limit for routes
+	Routes map[string]Limit `mapstructure:"routes"`
+}
+
+type options struct {
+	log   logging.Logger
+	route func(r *http.Request) string
+}
+
+// Option configures middleware
+type Option func(o *options)
+
+// WithLogger sets logger of limiter errors
+func WithLogger(logger logging.Logger) Option {
+	return func(o *options) {
+		o.log = logger
+	}
+}
+
+// WithRouteFunc sets route of request used to find route limit, request path is used by default
+func WithRouteFunc(route func(r *http.Request) string) Option {
+	return func(o *options) {
+		o.route = route
+	}
+}
+
+// Middleware limits requests with buckets per route and key, rejected requests get 429 Too Many Requests.
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers are set on limited routes.
+// Requests are allowed when limiter fails.
+func Middleware(name string, limiter Limiter, cfg Config, key KeyFunc, opts ...Option) middleware.Middleware {
+	o := options{
+		log:   logging.Component(name + "_rate_limit"),
+		route: func(r *http.Request) string { return r.URL.Path },
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := o.route(r)
+			limit, ok := cfg.Routes[route]
+			if !ok {
+				route, limit = defaultRoute, cfg.Default
+			}
+			k, limited := key(r)
+			if limit.IsZero() || !limited {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := limiter.Allow(r.Context(), route+":"+k, limit)
+			if err != nil {
+				o.log.Warnf("rate limiter error, request is allowed: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			setHeaders(w.Header(), res)
+			if !res.Allowed {
+				rejectedRequests.WithLabelValues(name, route).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				webtools.WriteProblem(w, r, webtools.Problem{
+					Title:  http.StatusText(http.StatusTooManyRequests),
+					Status: http.StatusTooManyRequests,
+					Detail: "rate limit exceeded",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func setHeaders(h http.Header, res Result) {
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const redisKeyPrefix = "ratelimit:"
+
+// tokenBucketScript takes token from bucket stored as hash with tokens and timestamp in microseconds.
+// It uses redis clock, so limiter instances don't depend on their clocks.
+// Returns allowed flag and tokens left multiplied by 1000.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local per_micro = tonumber(ARGV[2]) / 1000000
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+
+if now > ts then
+	tokens = math.min(capacity, tokens + (now - ts) * per_micro)
+	ts = now
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(ts))
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / per_micro / 1000) + 1000)
+return {allowed, math.floor(tokens * 1000)}
+`)
+
+// RedisLimiter keeps token buckets in redis, so limits are shared by service instances
+type RedisLimiter struct {
+	client redis.Scripter
+}
+
+var _ Limiter = (*RedisLimiter)(nil)
+
+func NewRedisLimiter(client redis.Scripter) *RedisLimiter {
+	return &RedisLimiter{client: client}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	res, err := tokenBucketScript.Run(ctx, l.client, []string{redisKeyPrefix + key},
+		strconv.FormatFloat(limit.capacity(), 'f', -1, 64),
+		strconv.FormatFloat(limit.perSecond(), 'f', -1, 64),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("error running rate limit script: %w", err)
+	}
+	if len(res) != 2 {
+		return Result{}, fmt.Errorf("unexpected rate limit script result %v", res)
+	}
+	return result(limit, res[0] == 1, float64(res[1])/1000), nil
+}
@@ -2,39 +2,60 @@ package enterprise
 
 import (
 	"context"
-	"sync"
 
-	"github.com/sirupsen/logrus"
+	"github.com/einherij/enterprise/logging"
 )
 
 type Runner interface {
 	Run(ctx context.Context)
 }
 
+// RunnerE is implemented by runners which are able to report failure.
+// App calls RunE instead of Run for such runners.
+type RunnerE interface {
+	RunE(ctx context.Context) error
+}
+
+// ReadyNotifier is implemented by runners which need time to become ready after start.
+// App starts dependants of such runner only after the Ready channel is closed,
+// other runners are considered ready as soon as they are started.
+type ReadyNotifier interface {
+	Ready() <-chan struct{}
+}
+
 type runner struct {
-	wg  sync.WaitGroup
-	log logrus.FieldLogger
+	log logging.Logger
 
-	task func(context.Context)
+	task func(context.Context) error
 }
 
+var _ RunnerE = (*runner)(nil)
+
 func NewRunner(name string, task func(context.Context)) Runner {
+	return NewRunnerE(name, func(ctx context.Context) error {
+		task(ctx)
+		return nil
+	})
+}
+
+// NewRunnerE returns runner which also implements RunnerE, so App is able to handle the task error
+func NewRunnerE(name string, task func(context.Context) error) Runner {
 	return &runner{
-		log:  logrus.WithField("component", name),
+		log:  logging.Component(name),
 		task: task,
 	}
 }
 
-func (r *runner) run(ctx context.Context) {
-	r.log.Info("Run worker")
-	defer r.wg.Done()
-
-	r.task(ctx)
+// Run blocks until the task is finished, so App is able to stop runners in order
+func (r *runner) Run(ctx context.Context) {
+	if err := r.RunE(ctx); err != nil {
+		r.log.Errorf("worker failed: %v", err)
+	}
 }
 
-func (r *runner) Run(ctx context.Context) {
-	r.wg.Add(1)
-	go r.run(ctx)
+func (r *runner) RunE(ctx context.Context) error {
+	r.log.Info("Run worker")
+	return r.task(ctx)
 }
 
 func RunnerFunc(start, stop func()) Runner {
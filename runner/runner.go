@@ -5,3 +5,7 @@ import "context"
 type Runner interface {
 	Run(ctx context.Context)
 }
+
+type RunnerE interface {
+	RunE(ctx context.Context) error
+}
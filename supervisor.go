@@ -0,0 +1,198 @@
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/einherij/enterprise/health"
+	"github.com/einherij/enterprise/logging"
+)
+
+type RestartPolicy string
+
+const (
+	RestartNever     RestartPolicy = "never"
+	RestartOnFailure RestartPolicy = "on_failure"
+	RestartAlways    RestartPolicy = "always"
+)
+
+const (
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = time.Minute
+	defaultRestartsWindow = 10 * time.Minute
+)
+
+var ErrTooManyRestarts = errors.New("too many restarts")
+
+var runnerRestarts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "runner_restarts_total",
+	Help: "Number of supervised runner restarts.",
+}, []string{"runner", "reason"})
+
+type SupervisorConfig struct {
+	Policy RestartPolicy `mapstructure:"policy" validate:"oneof=never on_failure always"`
+	// InitialBackoff is doubled after every restart within RestartsWindow up to MaxBackoff
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+	// MaxRestarts in RestartsWindow, zero means no limit
+	MaxRestarts int `mapstructure:"max_restarts"`
+	// RestartsWindow also resets backoff after runner works without restarts for this time
+	RestartsWindow time.Duration `mapstructure:"restarts_window"`
+}
+
+type supervisor struct {
+	name   string
+	log    logging.Logger
+	runner Runner
+	cfg    SupervisorConfig
+
+	restarts []time.Time
+}
+
+var (
+	_ RunnerE        = (*supervisor)(nil)
+	_ ReadyNotifier  = (*supervisor)(nil)
+	_ health.Checker = (*supervisor)(nil)
+)
+
+// NewSupervisor returns runner which restarts the given runner according to the restart policy.
+// Panics of the runner are recovered and handled as failures.
+// The supervisor returns error when the policy doesn't allow restart or when restarts limit is exceeded.
+func NewSupervisor(name string, runner Runner, cfg SupervisorConfig) Runner {
+	if cfg.Policy == "" {
+		cfg.Policy = RestartOnFailure
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = defaultInitialBackoff
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	if cfg.RestartsWindow <= 0 {
+		cfg.RestartsWindow = defaultRestartsWindow
+	}
+	return &supervisor{
+		name:   name,
+		log:    logging.Component(name),
+		runner: runner,
+		cfg:    cfg,
+	}
+}
+
+func (s *supervisor) Run(ctx context.Context) {
+	if err := s.RunE(ctx); err != nil {
+		s.log.Errorf("supervised runner failed: %v", err)
+	}
+}
+
+func (s *supervisor) RunE(ctx context.Context) error {
+	for {
+		err := s.runOnce(ctx)
+		if ctx.Err() != nil {
+			return err
+		}
+
+		var reason string
+		switch {
+		case err == nil && s.cfg.Policy != RestartAlways:
+			return nil
+		case err != nil && s.cfg.Policy == RestartNever:
+			return err
+		case err == nil:
+			reason = "exit"
+		case errors.As(err, new(*panicError)):
+			reason = "panic"
+		default:
+			reason = "failure"
+		}
+
+		if !s.allowRestart(time.Now()) {
+			return fmt.Errorf("%w: %d restarts in %v, last error: %v", ErrTooManyRestarts, s.cfg.MaxRestarts, s.cfg.RestartsWindow, err)
+		}
+		backoff := s.backoff()
+		s.log.Warnf("restarting runner in %v after %s: %v", backoff, reason, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil
+		}
+		runnerRestarts.WithLabelValues(s.name, reason).Inc()
+	}
+}
+
+// Ready delegates to the supervised runner, runner which doesn't notify readiness is ready at once
+func (s *supervisor) Ready() <-chan struct{} {
+	if notifier, ok := s.runner.(ReadyNotifier); ok {
+		return notifier.Ready()
+	}
+	ready := make(chan struct{})
+	close(ready)
+	return ready
+}
+
+// HealthCheck delegates to the supervised runner if it's health.Checker
+func (s *supervisor) HealthCheck(ctx context.Context) error {
+	if checker, ok := s.runner.(health.Checker); ok {
+		return checker.HealthCheck(ctx)
+	}
+	return nil
+}
+
+type panicError struct {
+	value any
+}
+
+func (pe *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", pe.value)
+}
+
+func (s *supervisor) runOnce(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.log.Errorf("runner panic: %v\n%s", r, debug.Stack())
+			err = &panicError{value: r}
+		}
+	}()
+	if runnerE, ok := s.runner.(RunnerE); ok {
+		return runnerE.RunE(ctx)
+	}
+	s.runner.Run(ctx)
+	return nil
+}
+
+// allowRestart keeps restarts in window and checks that limit isn't exceeded
+func (s *supervisor) allowRestart(now time.Time) bool {
+	var inWindow = s.restarts[:0]
+	for _, t := range s.restarts {
+		if now.Sub(t) < s.cfg.RestartsWindow {
+			inWindow = append(inWindow, t)
+		}
+	}
+	s.restarts = inWindow
+	if s.cfg.MaxRestarts > 0 && len(s.restarts) >= s.cfg.MaxRestarts {
+		return false
+	}
+	s.restarts = append(s.restarts, now)
+	return true
+}
+
+// backoff grows exponentially with recent restarts, a half of it is random jitter
+func (s *supervisor) backoff() time.Duration {
+	var backoff = s.cfg.InitialBackoff
+	for i := 1; i < len(s.restarts) && backoff < s.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > s.cfg.MaxBackoff {
+		backoff = s.cfg.MaxBackoff
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
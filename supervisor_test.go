@@ -0,0 +1,147 @@
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/einherij/enterprise/health"
+)
+
+type SupervisorSuite struct {
+	suite.Suite
+
+	cfg SupervisorConfig
+}
+
+func TestSupervisor(t *testing.T) {
+	suite.Run(t, new(SupervisorSuite))
+}
+
+func (s *SupervisorSuite) SetupTest() {
+	s.cfg = SupervisorConfig{
+		Policy:         RestartOnFailure,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	}
+}
+
+func (s *SupervisorSuite) TestRestartAfterPanic() {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		runs        int
+	)
+	defer cancel()
+	restartsBefore := testutil.ToFloat64(runnerRestarts.WithLabelValues("panicking", "panic"))
+	sup := NewSupervisor("panicking", NewRunner("panicking", func(ctx context.Context) {
+		runs++
+		if runs < 3 {
+			panic("something went wrong")
+		}
+		cancel()
+	}), s.cfg)
+
+	s.NoError(sup.(RunnerE).RunE(ctx))
+	s.Equal(3, runs)
+	s.Equal(restartsBefore+2, testutil.ToFloat64(runnerRestarts.WithLabelValues("panicking", "panic")))
+}
+
+func (s *SupervisorSuite) TestNoRestartOnSuccess() {
+	var runs int
+	sup := NewSupervisor("finishing", NewRunner("finishing", func(ctx context.Context) {
+		runs++
+	}), s.cfg)
+
+	s.NoError(sup.(RunnerE).RunE(context.Background()))
+	s.Equal(1, runs)
+}
+
+func (s *SupervisorSuite) TestRestartNever() {
+	var (
+		runs    int
+		taskErr = errors.New("task error")
+	)
+	s.cfg.Policy = RestartNever
+	sup := NewSupervisor("failing", NewRunnerE("failing", func(ctx context.Context) error {
+		runs++
+		return taskErr
+	}), s.cfg)
+
+	s.ErrorIs(sup.(RunnerE).RunE(context.Background()), taskErr)
+	s.Equal(1, runs)
+}
+
+func (s *SupervisorSuite) TestTooManyRestarts() {
+	var runs int
+	s.cfg.Policy = RestartAlways
+	s.cfg.MaxRestarts = 3
+	s.cfg.RestartsWindow = time.Minute
+	sup := NewSupervisor("restarting", NewRunner("restarting", func(ctx context.Context) {
+		runs++
+	}), s.cfg)
+
+	s.ErrorIs(sup.(RunnerE).RunE(context.Background()), ErrTooManyRestarts)
+	s.Equal(4, runs)
+}
+
+func (s *SupervisorSuite) TestBackoff() {
+	sup := NewSupervisor("backoff", nil, SupervisorConfig{
+		InitialBackoff: time.Second,
+		MaxBackoff:     10 * time.Second,
+	}).(*supervisor)
+
+	now := time.Now()
+	for i, maxBackoff := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second} {
+		s.True(sup.allowRestart(now.Add(time.Duration(i) * time.Millisecond)))
+		backoff := sup.backoff()
+		s.LessOrEqual(backoff, maxBackoff)
+		s.GreaterOrEqual(backoff, maxBackoff/2)
+	}
+
+	// backoff is reset after restarts window
+	s.True(sup.allowRestart(now.Add(defaultRestartsWindow + time.Second)))
+	s.LessOrEqual(sup.backoff(), time.Second)
+}
+
+type readyCheckedRunner struct {
+	ready chan struct{}
+	err   error
+}
+
+func (r *readyCheckedRunner) Run(ctx context.Context) {
+	close(r.ready)
+	<-ctx.Done()
+}
+
+func (r *readyCheckedRunner) Ready() <-chan struct{} {
+	return r.ready
+}
+
+func (r *readyCheckedRunner) HealthCheck(ctx context.Context) error {
+	return r.err
+}
+
+func (s *SupervisorSuite) TestDelegatesReadyAndHealthCheck() {
+	inner := &readyCheckedRunner{ready: make(chan struct{}), err: errors.New("unhealthy")}
+	sup := NewSupervisor("delegating", inner, s.cfg)
+
+	notifier, ok := sup.(ReadyNotifier)
+	s.Require().True(ok)
+	s.Equal((<-chan struct{})(inner.ready), notifier.Ready())
+	checker, ok := sup.(health.Checker)
+	s.Require().True(ok)
+	s.ErrorIs(checker.HealthCheck(context.Background()), inner.err)
+
+	// runner without readiness and health check is ready and healthy
+	sup = NewSupervisor("plain", NewRunner("plain", func(ctx context.Context) {}), s.cfg)
+	s.NoError(sup.(health.Checker).HealthCheck(context.Background()))
+	select {
+	case <-sup.(ReadyNotifier).Ready():
+	default:
+		s.Fail("runner isn't ready")
+	}
+}
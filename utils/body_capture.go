@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// TruncationMarker is appended to text of truncated captures
+	TruncationMarker = "...[truncated]"
+
+	// maxPooledBufferSize prevents keeping huge buffers in pool
+	maxPooledBufferSize = 1 << 20
+)
+
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(buf)
+	}
+}
+
+// BodyCapture keeps up to max bytes of body which is written to it.
+// It is used as tee of request and response bodies, so bodies are streamed and not read twice.
+// Release returns the buffer to pool, the capture can't be used after it.
+type BodyCapture struct {
+	mux       sync.Mutex
+	buf       *bytes.Buffer
+	max       int
+	size      int64
+	truncated bool
+	encoding  string
+}
+
+var _ io.Writer = (*BodyCapture)(nil)
+
+// NewBodyCapture creates capture of up to max bytes of body with the given Content-Encoding
+func NewBodyCapture(max int, contentEncoding string) *BodyCapture {
+	return &BodyCapture{
+		buf:      getBuffer(),
+		max:      max,
+		encoding: strings.ToLower(strings.TrimSpace(contentEncoding)),
+	}
+}
+
+// Write always consumes all bytes, bytes above max are only counted
+func (c *BodyCapture) Write(p []byte) (int, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.buf == nil {
+		return len(p), nil
+	}
+	c.size += int64(len(p))
+	if room := c.max - c.buf.Len(); room < len(p) {
+		c.truncated = true
+		if room > 0 {
+			c.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	c.buf.Write(p)
+	return len(p), nil
+}
+
+// Size returns total size of body written to capture
+func (c *BodyCapture) Size() int64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.size
+}
+
+// Truncated returns true if raw or decoded body is larger than max size,
+// the latter is known only after Decoded is called
+func (c *BodyCapture) Truncated() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.truncated
+}
+
+// Bytes returns copy of captured raw bytes
+func (c *BodyCapture) Bytes() []byte {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.buf == nil {
+		return nil
+	}
+	return append([]byte(nil), c.buf.Bytes()...)
+}
+
+// Decoded returns captured body decoded according to Content-Encoding, limited to max bytes.
+// Truncated bodies are decoded as far as possible.
+func (c *BodyCapture) Decoded() ([]byte, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.buf == nil {
+		return nil, nil
+	}
+	if c.encoding == "" || c.encoding == "identity" {
+		return append([]byte(nil), c.buf.Bytes()...), nil
+	}
+	reader, err := newDecoder(c.encoding, bytes.NewReader(c.buf.Bytes()))
+	if err != nil {
+		if c.truncated && c.buf.Len() == 0 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error decoding %s body: %w", c.encoding, err)
+	}
+	defer reader.Close()
+
+	out := getBuffer()
+	defer putBuffer(out)
+	// one extra byte shows that decoded body doesn't fit into max size
+	_, err = io.Copy(out, io.LimitReader(reader, int64(c.max)+1))
+	// decoding of truncated stream fails at its end
+	if err != nil && !c.truncated {
+		return nil, fmt.Errorf("error decoding %s body: %w", c.encoding, err)
+	}
+	if out.Len() > c.max {
+		out.Truncate(c.max)
+		c.truncated = true
+	}
+	return append([]byte(nil), out.Bytes()...), nil
+}
+
+// Text returns decoded body with TruncationMarker if body is truncated
+func (c *BodyCapture) Text() (string, error) {
+	decoded, err := c.Decoded()
+	if err != nil {
+		return "", err
+	}
+	if c.Truncated() {
+		return string(decoded) + TruncationMarker, nil
+	}
+	return string(decoded), nil
+}
+
+// Release returns buffer to pool
+func (c *BodyCapture) Release() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.buf != nil {
+		putBuffer(c.buf)
+		c.buf = nil
+	}
+}
+
+func newDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case contentEncodingGZIP, "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		// deflate is zlib wrapped, but some servers send raw deflate
+		br := &peekReader{r: r}
+		zr, err := zlib.NewReader(br)
+		if err == nil {
+			return zr, nil
+		}
+		return flate.NewReader(io.MultiReader(bytes.NewReader(br.peeked), r)), nil
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// peekReader remembers read bytes to read them again with another decoder
+type peekReader struct {
+	r      io.Reader
+	peeked []byte
+}
+
+func (p *peekReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.peeked = append(p.peeked, b[:n]...)
+	return n, err
+}
+
+// CaptureRequestBody tees request body into capture of up to max bytes while it is read by handler
+func CaptureRequestBody(r *http.Request, max int) *BodyCapture {
+	capture := NewBodyCapture(max, r.Header.Get(contentEncodingHeader))
+	if r.Body != nil && r.Body != http.NoBody {
+		body := r.Body
+		r.Body = CloserFunc(io.TeeReader(body, capture), body.Close)
+	}
+	return capture
+}
+
+// CaptureResponseBody tees response body into capture of up to max bytes while it is read by client
+func CaptureResponseBody(r *http.Response, max int) *BodyCapture {
+	capture := NewBodyCapture(max, r.Header.Get(contentEncodingHeader))
+	if r.Body != nil && r.Body != http.NoBody {
+		body := r.Body
+		r.Body = CloserFunc(io.TeeReader(body, capture), body.Close)
+	}
+	return capture
+}
+
+// String describes capture for logs
+func (c *BodyCapture) String() string {
+	text, err := c.Text()
+	if err != nil {
+		return "<" + err.Error() + ", " + strconv.FormatInt(c.Size(), 10) + " bytes>"
+	}
+	return text
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encode(t *testing.T, encoding string, content []byte) []byte {
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+		err error
+	)
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, err = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		w, err = zstd.NewWriter(&buf)
+	default:
+		return content
+	}
+	require.NoError(t, err)
+	_, err = w.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func Test_CaptureResponseBody(t *testing.T) {
+	content := []byte(strings.Repeat("response body content\n", 10))
+	for _, tt := range []struct {
+		name     string
+		encoding string
+		header   string
+	}{
+		{name: "Identity", encoding: "", header: ""},
+		{name: "Gzip", encoding: "gzip", header: "gzip"},
+		{name: "Deflate", encoding: "deflate", header: "deflate"},
+		{name: "RawDeflate", encoding: "raw-deflate", header: "deflate"},
+		{name: "Brotli", encoding: "br", header: "br"},
+		{name: "Zstd", encoding: "zstd", header: "zstd"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			encoded := encode(t, tt.encoding, content)
+			resp := &http.Response{
+				Header: http.Header{"Content-Encoding": {tt.header}},
+				Body:   io.NopCloser(bytes.NewReader(encoded)),
+			}
+			capture := CaptureResponseBody(resp, 1024)
+			defer capture.Release()
+
+			read, err := io.ReadAll(resp.Body)
+			a.NoError(err)
+			a.NoError(resp.Body.Close())
+			a.Equal(encoded, read)
+
+			a.False(capture.Truncated())
+			a.Equal(int64(len(encoded)), capture.Size())
+			text, err := capture.Text()
+			a.NoError(err)
+			a.Equal(string(content), text)
+		})
+	}
+}
+
+func Test_CaptureRequestBodyTruncated(t *testing.T) {
+	a := assert.New(t)
+	req, err := http.NewRequest(http.MethodPost, "https://example.com", strings.NewReader("0123456789"))
+	require.NoError(t, err)
+	capture := CaptureRequestBody(req, 4)
+	defer capture.Release()
+
+	read, err := io.ReadAll(req.Body)
+	a.NoError(err)
+	a.Equal("0123456789", string(read))
+	a.True(capture.Truncated())
+	a.Equal(int64(10), capture.Size())
+	a.Equal([]byte("0123"), capture.Bytes())
+	text, err := capture.Text()
+	a.NoError(err)
+	a.Equal("0123"+TruncationMarker, text)
+}
+
+func Test_CaptureTruncatedCompressed(t *testing.T) {
+	a := assert.New(t)
+	var content []byte
+	for i := 0; i < 1000; i++ {
+		content = strconv.AppendInt(content, int64(i*i*7919), 36)
+		content = append(content, '\n')
+	}
+	capture := NewBodyCapture(256, "gzip")
+	defer capture.Release()
+	_, err := capture.Write(encode(t, "gzip", content))
+	a.NoError(err)
+
+	a.True(capture.Truncated())
+	decoded, err := capture.Decoded()
+	a.NoError(err)
+	a.LessOrEqual(len(decoded), 256)
+	a.True(bytes.HasPrefix(content, decoded))
+}
+
+func Test_CaptureDecodedLargerThanMax(t *testing.T) {
+	a := assert.New(t)
+	content := bytes.Repeat([]byte("a"), 64*1024)
+	compressed := encode(t, "gzip", content)
+	capture := NewBodyCapture(1024, "gzip")
+	defer capture.Release()
+	a.Less(len(compressed), 1024)
+	_, err := capture.Write(compressed)
+	a.NoError(err)
+	a.False(capture.Truncated())
+
+	text, err := capture.Text()
+	a.NoError(err)
+	a.Equal(string(content[:1024])+TruncationMarker, text)
+	a.True(capture.Truncated())
+}
+
+func Test_CaptureDecodingError(t *testing.T) {
+	capture := NewBodyCapture(1024, "gzip")
+	defer capture.Release()
+	_, err := capture.Write([]byte("not gzip"))
+	assert.NoError(t, err)
+	_, err = capture.Text()
+	assert.Error(t, err)
+
+	capture = NewBodyCapture(1024, "compress")
+	defer capture.Release()
+	_, err = capture.Text()
+	assert.Error(t, err)
+}
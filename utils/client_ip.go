@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	forwardedHeader = "Forwarded"
+	xRealIPHeader   = "X-Real-IP"
+)
+
+var defaultIPHeaders = []string{forwardedHeader, xForwardedForHeader, xRealIPHeader}
+
+// privateNetworks are trusted by DefaultIPResolver
+var privateNetworks = []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+
+// DefaultIPResolver trusts proxies from loopback and private networks
+var DefaultIPResolver = MustIPResolver(IPResolverConfig{TrustedProxies: privateNetworks})
+
+type IPResolverConfig struct {
+	// TrustedProxies are CIDRs or addresses of proxies which are allowed to set forwarding headers
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	// Headers are checked in order, supported are Forwarded, X-Forwarded-For and X-Real-IP, all of them by default
+	Headers []string `mapstructure:"headers"`
+}
+
+// IPResolver finds client IP in forwarding headers set by trusted proxies
+type IPResolver struct {
+	trusted []netip.Prefix
+	headers []string
+}
+
+func NewIPResolver(cfg IPResolverConfig) (*IPResolver, error) {
+	r := &IPResolver{
+		headers: defaultIPHeaders,
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing trusted proxy %q: %w", proxy, err)
+			}
+			addr = addr.Unmap()
+			r.trusted = append(r.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing trusted proxy %q: %w", proxy, err)
+		}
+		r.trusted = append(r.trusted, prefix.Masked())
+	}
+	if len(cfg.Headers) > 0 {
+		r.headers = nil
+		for _, header := range cfg.Headers {
+			header = http.CanonicalHeaderKey(header)
+			if header == "X-Real-Ip" {
+				header = xRealIPHeader
+			}
+			if !IsInSlice(header, defaultIPHeaders) {
+				return nil, fmt.Errorf("unsupported client ip header %q", header)
+			}
+			r.headers = append(r.headers, header)
+		}
+	}
+	return r, nil
+}
+
+func MustIPResolver(cfg IPResolverConfig) *IPResolver {
+	r, err := NewIPResolver(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// ClientIP returns normalized client IP or empty string if remote address is invalid
+func (r *IPResolver) ClientIP(req *http.Request) string {
+	addr := r.ClientAddr(req)
+	if !addr.IsValid() {
+		return ""
+	}
+	return addr.String()
+}
+
+// ClientAddr returns the first untrusted address walking from the remote address through forwarding headers.
+// Headers are used only if the request comes from trusted proxy.
+func (r *IPResolver) ClientAddr(req *http.Request) netip.Addr {
+	remote := parseIPAddr(req.RemoteAddr)
+	if !remote.IsValid() || !r.isTrusted(remote) {
+		return remote
+	}
+	for _, header := range r.headers {
+		values := req.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+		switch header {
+		case forwardedHeader:
+			return r.walk(remote, forwardedFor(values))
+		case xForwardedForHeader:
+			return r.walk(remote, splitList(values))
+		case xRealIPHeader:
+			if addr := parseIPAddr(values[0]); addr.IsValid() {
+				return addr
+			}
+			return remote
+		}
+	}
+	return remote
+}
+
+// walk goes through chain from right to left and returns the first address which isn't trusted proxy
+func (r *IPResolver) walk(remote netip.Addr, chain []string) netip.Addr {
+	var client = remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr := parseIPAddr(chain[i])
+		if !addr.IsValid() {
+			// forged or obfuscated hop, nothing left of it can be trusted
+			return client
+		}
+		client = addr
+		if !r.isTrusted(addr) {
+			return addr
+		}
+	}
+	return client
+}
+
+func (r *IPResolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIPAddr parses address with optional port, brackets and quotes, IPv4-mapped IPv6 is converted to IPv4
+func parseIPAddr(s string) netip.Addr {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if s == "" {
+		return netip.Addr{}
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		host, _, splitErr := net.SplitHostPort(s)
+		if splitErr != nil {
+			host = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+		}
+		if addr, err = netip.ParseAddr(host); err != nil {
+			return netip.Addr{}
+		}
+	}
+	return addr.Unmap().WithZone("")
+}
+
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		list = append(list, strings.Split(value, ",")...)
+	}
+	return list
+}
+
+// forwardedFor returns "for" parameters of Forwarded header elements (RFC 7239)
+func forwardedFor(values []string) []string {
+	var list []string
+	for _, element := range splitList(values) {
+		var forValue string
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				forValue = value
+			}
+		}
+		list = append(list, forValue)
+	}
+	return list
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_IPResolver(t *testing.T) {
+	resolver, err := NewIPResolver(IPResolverConfig{TrustedProxies: []string{"10.0.0.0/8", "2001:db8::1"}})
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name       string
+		remoteAddr string
+		headers    http.Header
+		ip         string
+	}{
+		{
+			name:       "InvalidRemoteAddr",
+			remoteAddr: "unknown",
+			ip:         "",
+		},
+		{
+			name:       "UntrustedRemoteIgnoresHeaders",
+			remoteAddr: "203.0.113.5:1234",
+			headers:    http.Header{"X-Forwarded-For": {"1.1.1.1"}},
+			ip:         "203.0.113.5",
+		},
+		{
+			name:       "ForwardedForRightToLeft",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    http.Header{"X-Forwarded-For": {"6.6.6.6, 198.51.100.7, 10.0.0.2"}},
+			ip:         "198.51.100.7",
+		},
+		{
+			name:       "ForwardedForMultipleHeaders",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    http.Header{"X-Forwarded-For": {"6.6.6.6", "198.51.100.7"}},
+			ip:         "198.51.100.7",
+		},
+		{
+			name:       "ForwardedForAllTrusted",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			ip:         "10.0.0.3",
+		},
+		{
+			name:       "ForwardedForGarbage",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    http.Header{"X-Forwarded-For": {"198.51.100.7, garbage, 10.0.0.2"}},
+			ip:         "10.0.0.2",
+		},
+		{
+			name:       "RFC7239",
+			remoteAddr: "[2001:db8::1]:443",
+			headers:    http.Header{"Forwarded": {`for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"`}},
+			ip:         "2001:db8:cafe::17",
+		},
+		{
+			name:       "RFC7239Obfuscated",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    http.Header{"Forwarded": {"for=_hidden"}},
+			ip:         "10.0.0.1",
+		},
+		{
+			name:       "ForwardedPreferred",
+			remoteAddr: "10.0.0.1:1234",
+			headers: http.Header{
+				"Forwarded":       {"for=192.0.2.60"},
+				"X-Forwarded-For": {"198.51.100.7"},
+			},
+			ip: "192.0.2.60",
+		},
+		{
+			name:       "RealIP",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    http.Header{"X-Real-Ip": {"198.51.100.7"}},
+			ip:         "198.51.100.7",
+		},
+		{
+			name:       "IPv4MappedIPv6",
+			remoteAddr: "[::ffff:10.0.0.1]:1234",
+			headers:    http.Header{"X-Forwarded-For": {"::ffff:198.51.100.7"}},
+			ip:         "198.51.100.7",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &http.Request{RemoteAddr: tt.remoteAddr, Header: tt.headers}
+			assert.Equal(t, tt.ip, resolver.ClientIP(req))
+		})
+	}
+}
+
+func Test_NewIPResolver(t *testing.T) {
+	_, err := NewIPResolver(IPResolverConfig{TrustedProxies: []string{"10.0.0.0/33"}})
+	assert.Error(t, err)
+	_, err = NewIPResolver(IPResolverConfig{TrustedProxies: []string{"proxy"}})
+	assert.Error(t, err)
+	_, err = NewIPResolver(IPResolverConfig{Headers: []string{"X-Client-IP"}})
+	assert.Error(t, err)
+
+	resolver, err := NewIPResolver(IPResolverConfig{
+		TrustedProxies: []string{"10.0.0.1"},
+		Headers:        []string{"x-real-ip"},
+	})
+	require.NoError(t, err)
+	req := &http.Request{RemoteAddr: "10.0.0.1:1", Header: http.Header{
+		"X-Forwarded-For": {"198.51.100.7"},
+		"X-Real-Ip":       {"192.0.2.60"},
+	}}
+	assert.Equal(t, "192.0.2.60", resolver.ClientIP(req))
+}
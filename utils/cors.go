@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	originHeader = "Origin"
+	varyHeader   = "Vary"
+
+	corsAllowOriginHeader      = "Access-Control-Allow-Origin"
+	corsAllowMethodsHeader     = "Access-Control-Allow-Methods"
+	corsAllowHeadersHeader     = "Access-Control-Allow-Headers"
+	corsAllowCredentialsHeader = "Access-Control-Allow-Credentials"
+	corsExposeHeadersHeader    = "Access-Control-Expose-Headers"
+	corsMaxAgeHeader           = "Access-Control-Max-Age"
+	corsRequestMethodHeader    = "Access-Control-Request-Method"
+	corsRequestHeadersHeader   = "Access-Control-Request-Headers"
+)
+
+var defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions}
+
+// CORSPolicy describes which cross-origin requests are allowed
+type CORSPolicy struct {
+	// AllowedOrigins are exact origins or patterns with wildcards, e.g. https://*.example.com, "*" allows any origin
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+	// AllowedMethods are GET, POST, PUT, DELETE and OPTIONS by default
+	AllowedMethods []string `mapstructure:"allowed_methods"`
+	// AllowedHeaders can be requested in preflight, "*" allows any header
+	AllowedHeaders []string `mapstructure:"allowed_headers"`
+	// ExposedHeaders are available to browser scripts
+	ExposedHeaders   []string      `mapstructure:"exposed_headers"`
+	AllowCredentials bool          `mapstructure:"allow_credentials"`
+	MaxAge           time.Duration `mapstructure:"max_age"`
+}
+
+type cors struct {
+	anyOrigin      bool
+	origins        map[string]struct{}
+	patterns       []*regexp.Regexp
+	methods        string
+	methodsSet     map[string]struct{}
+	anyHeader      bool
+	headersSet     map[string]struct{}
+	exposedHeaders string
+	credentials    bool
+	maxAge         string
+}
+
+// WrapForCORSPolicy handles CORS according to the policy.
+// Allowed origin is reflected in response, preflight requests are answered without calling handler.
+func WrapForCORSPolicy(handler http.Handler, policy CORSPolicy) http.Handler {
+	c := newCORS(policy)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions && r.Header.Get(corsRequestMethodHeader) != "" {
+			c.preflight(w, r)
+			return
+		}
+		c.actual(w, r)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func newCORS(policy CORSPolicy) *cors {
+	c := &cors{
+		origins:     make(map[string]struct{}),
+		methodsSet:  make(map[string]struct{}),
+		headersSet:  make(map[string]struct{}),
+		credentials: policy.AllowCredentials,
+	}
+	for _, origin := range policy.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "*":
+			c.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			pattern := strings.ReplaceAll(regexp.QuoteMeta(origin), `\*`, `[^/]*`)
+			c.patterns = append(c.patterns, regexp.MustCompile("^"+pattern+"$"))
+		default:
+			c.origins[origin] = struct{}{}
+		}
+	}
+
+	methods := policy.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	for i := range methods {
+		c.methodsSet[strings.ToUpper(methods[i])] = struct{}{}
+	}
+	c.methods = strings.ToUpper(strings.Join(methods, ", "))
+
+	for _, header := range policy.AllowedHeaders {
+		if header == "*" {
+			c.anyHeader = true
+			continue
+		}
+		c.headersSet[http.CanonicalHeaderKey(strings.TrimSpace(header))] = struct{}{}
+	}
+	c.exposedHeaders = strings.Join(policy.ExposedHeaders, ", ")
+	if policy.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(policy.MaxAge / time.Second))
+	}
+	return c
+}
+
+func (c *cors) originAllowed(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if _, ok := c.origins[origin]; ok {
+		return true
+	}
+	for _, pattern := range c.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// setOrigin writes allowed origin, wildcard is used only when any origin is allowed without credentials
+func (c *cors) setOrigin(h http.Header, origin string) {
+	if c.anyOrigin && !c.credentials {
+		h.Set(corsAllowOriginHeader, "*")
+	} else {
+		h.Set(corsAllowOriginHeader, origin)
+	}
+	if c.credentials {
+		h.Set(corsAllowCredentialsHeader, "true")
+	}
+}
+
+func (c *cors) actual(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add(varyHeader, originHeader)
+	origin := r.Header.Get(originHeader)
+	if origin == "" || !c.originAllowed(origin) {
+		return
+	}
+	c.setOrigin(h, origin)
+	if c.exposedHeaders != "" {
+		h.Set(corsExposeHeadersHeader, c.exposedHeaders)
+	}
+}
+
+func (c *cors) preflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add(varyHeader, originHeader)
+	h.Add(varyHeader, corsRequestMethodHeader)
+	h.Add(varyHeader, corsRequestHeadersHeader)
+	defer w.WriteHeader(http.StatusNoContent)
+
+	origin := r.Header.Get(originHeader)
+	if origin == "" || !c.originAllowed(origin) {
+		return
+	}
+	if _, ok := c.methodsSet[strings.ToUpper(r.Header.Get(corsRequestMethodHeader))]; !ok {
+		return
+	}
+	requested := r.Header.Get(corsRequestHeadersHeader)
+	if !c.headersAllowed(requested) {
+		return
+	}
+
+	c.setOrigin(h, origin)
+	h.Set(corsAllowMethodsHeader, c.methods)
+	if requested != "" {
+		h.Set(corsAllowHeadersHeader, requested)
+	}
+	if c.maxAge != "" {
+		h.Set(corsMaxAgeHeader, c.maxAge)
+	}
+}
+
+func (c *cors) headersAllowed(requested string) bool {
+	if c.anyHeader || requested == "" {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+		if header == "" {
+			continue
+		}
+		if _, ok := c.headersSet[header]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Wrap is WrapForCORSPolicy with this policy, it can be used as middleware
+func (p CORSPolicy) Wrap(handler http.Handler) http.Handler {
+	return WrapForCORSPolicy(handler, p)
+}
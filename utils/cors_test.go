@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WrapForCORSPolicy(t *testing.T) {
+	policy := CORSPolicy{
+		AllowedOrigins:   []string{"https://dashboard.example.com", "https://*.ads.example.com"},
+		AllowedHeaders:   []string{"Content-Type", "X-Request-ID"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	for _, tt := range []struct {
+		name           string
+		method         string
+		headers        map[string]string
+		status         int
+		handlerCalled  bool
+		allowOrigin    string
+		allowMethods   string
+		allowHeaders   string
+		exposedHeaders string
+	}{
+		{
+			name:          "NoOrigin",
+			method:        http.MethodGet,
+			status:        http.StatusOK,
+			handlerCalled: true,
+		},
+		{
+			name:           "ExactOrigin",
+			method:         http.MethodGet,
+			headers:        map[string]string{"Origin": "https://dashboard.example.com"},
+			status:         http.StatusOK,
+			handlerCalled:  true,
+			allowOrigin:    "https://dashboard.example.com",
+			exposedHeaders: "X-Request-ID",
+		},
+		{
+			name:           "PatternOrigin",
+			method:         http.MethodPost,
+			headers:        map[string]string{"Origin": "https://eu.ads.example.com"},
+			status:         http.StatusOK,
+			handlerCalled:  true,
+			allowOrigin:    "https://eu.ads.example.com",
+			exposedHeaders: "X-Request-ID",
+		},
+		{
+			name:          "NotAllowedOrigin",
+			method:        http.MethodGet,
+			headers:       map[string]string{"Origin": "https://evil.com"},
+			status:        http.StatusOK,
+			handlerCalled: true,
+		},
+		{
+			name:   "Preflight",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://dashboard.example.com",
+				"Access-Control-Request-Method":  "PUT",
+				"Access-Control-Request-Headers": "content-type, x-request-id",
+			},
+			status:       http.StatusNoContent,
+			allowOrigin:  "https://dashboard.example.com",
+			allowMethods: "GET, POST, PUT, DELETE, OPTIONS",
+			allowHeaders: "content-type, x-request-id",
+		},
+		{
+			name:   "PreflightNotAllowedHeader",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://dashboard.example.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "Authorization",
+			},
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "PreflightNotAllowedMethod",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://dashboard.example.com",
+				"Access-Control-Request-Method": "PATCH",
+			},
+			status: http.StatusNoContent,
+		},
+		{
+			name:           "PlainOptions",
+			method:         http.MethodOptions,
+			headers:        map[string]string{"Origin": "https://dashboard.example.com"},
+			status:         http.StatusOK,
+			handlerCalled:  true,
+			allowOrigin:    "https://dashboard.example.com",
+			exposedHeaders: "X-Request-ID",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			var called bool
+			handler := WrapForCORSPolicy(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}), policy)
+
+			r := httptest.NewRequest(tt.method, "/", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			a.Equal(tt.status, w.Code)
+			a.Equal(tt.handlerCalled, called)
+			a.Contains(w.Header().Values("Vary"), "Origin")
+			a.Equal(tt.allowOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			a.Equal(tt.allowMethods, w.Header().Get("Access-Control-Allow-Methods"))
+			a.Equal(tt.allowHeaders, w.Header().Get("Access-Control-Allow-Headers"))
+			a.Equal(tt.exposedHeaders, w.Header().Get("Access-Control-Expose-Headers"))
+			if tt.allowOrigin != "" {
+				a.Equal("true", w.Header().Get("Access-Control-Allow-Credentials"))
+			}
+			if tt.allowMethods != "" {
+				a.Equal("600", w.Header().Get("Access-Control-Max-Age"))
+			}
+		})
+	}
+}
+
+func Test_WrapForCORSPolicyAnyOrigin(t *testing.T) {
+	a := assert.New(t)
+	handler := CORSPolicy{AllowedOrigins: []string{"*"}}.Wrap(http.NotFoundHandler())
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://any.com")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	a.Equal("*", w.Header().Get("Access-Control-Allow-Origin"))
+	a.Empty(w.Header().Get("Access-Control-Allow-Credentials"))
+}
@@ -10,9 +10,13 @@ import (
 	"net/url"
 
 	"github.com/avct/uasurfer"
-	"github.com/sirupsen/logrus"
+
+	"github.com/einherij/enterprise/db/maxmind"
+	"github.com/einherij/enterprise/logging"
 )
 
+var httpLog = logging.Component("http_utils")
+
 const (
 	contentEncodingHeader = "Content-Encoding"
 	contentEncodingGZIP   = "gzip"
@@ -25,16 +29,55 @@ const (
 )
 
 type Request struct {
-	Domain          string
-	PageURL         string
-	OS              string
-	DeviceType      string
+	Domain     string
+	PageURL    string
+	OS         string
+	OSVersion  string
+	DeviceType string
+	// Browser is uasurfer browser name parsed from User-Agent, e.g. BrowserChrome
+	Browser        string
+	BrowserVersion string
+	// BrowserBrand is brand name from client hints, e.g. Google Chrome, it's empty when hints aren't sent
+	BrowserBrand        string
+	BrowserBrandVersion string
+	IsBot               bool
+	// BrowserLanguage is primary language subtag of the most preferred language
 	BrowserLanguage string
-	UA              string
-	IP              string
+	Languages       []Language
+	// ClientHints are nil when browser doesn't send them
+	ClientHints *ClientHints
+	UA          string
+	IP          string
+	Geo         maxmind.Info
+}
+
+// ParseOption configures ParseGetRequest
+type ParseOption func(o *parseOptions)
+
+type parseOptions struct {
+	ipResolver *IPResolver
+	geoIP      maxmind.DB
+}
+
+// WithIPResolver sets resolver of client IP, DefaultIPResolver is used by default
+func WithIPResolver(resolver *IPResolver) ParseOption {
+	return func(o *parseOptions) {
+		o.ipResolver = resolver
+	}
+}
+
+// WithGeoIP enables filling Geo of request from the database
+func WithGeoIP(db maxmind.DB) ParseOption {
+	return func(o *parseOptions) {
+		o.geoIP = db
+	}
 }
 
-func ParseGetRequest(httpReq *http.Request) (req *Request, err error) {
+func ParseGetRequest(httpReq *http.Request, opts ...ParseOption) (req *Request, err error) {
+	var o = parseOptions{ipResolver: DefaultIPResolver}
+	for _, opt := range opts {
+		opt(&o)
+	}
 	req = new(Request)
 
 	if refStr := httpReq.Referer(); refStr != "" {
@@ -42,26 +85,45 @@ func ParseGetRequest(httpReq *http.Request) (req *Request, err error) {
 		if err != nil {
 			return req, fmt.Errorf("error parsing referer: %w", err)
 		}
-		req.PageURL = fmt.Sprintf("%s://%s%s", refURL.Scheme, refURL.Host, refURL.Path)
+		req.PageURL = refURL.Scheme + "://" + refURL.Host + refURL.Path
 		req.Domain = refURL.Hostname()
 	}
 
 	if uaStr := httpReq.UserAgent(); uaStr != "" {
-		ua := uasurfer.Parse(uaStr)
-		req.UA = uaStr
-		req.OS = ua.OS.Name.String()
-		req.DeviceType = ua.DeviceType.String()
+		parseUserAgent(req, uaStr)
 	}
-
-	if langStr := httpReq.Header.Get(acceptLanguageHeader); len(langStr) >= 2 {
-		req.BrowserLanguage = langStr[:2] // cut two-letter language
+	if hints := parseClientHints(httpReq.Header); hints != nil {
+		req.ClientHints = hints
+		if brand, ok := hints.mainBrand(); ok {
+			req.BrowserBrand, req.BrowserBrandVersion = brand.Name, brand.Version
+		}
+		if hints.PlatformVersion != "" {
+			req.OSVersion = hints.PlatformVersion
+		}
+		if hints.Mobile && req.DeviceType != uasurfer.DeviceTablet.String() {
+			req.DeviceType = uasurfer.DevicePhone.String()
+		}
 	}
 
-	req.IP = GetRequestIP(httpReq)
+	req.Languages = ParseAcceptLanguage(httpReq.Header.Get(acceptLanguageHeader))
+	req.BrowserLanguage = primaryLanguage(req.Languages)
+
+	req.IP = o.ipResolver.ClientIP(httpReq)
+
+	if o.geoIP != nil && req.IP != "" {
+		// geo is optional, e.g. private addresses aren't in the database
+		if req.Geo, err = o.geoIP.Lookup(net.ParseIP(req.IP)); err != nil {
+			httpLog.Debugf("error looking up geoip of %s: %v", req.IP, err)
+			req.Geo = maxmind.Info{}
+		}
+	}
 
 	return req, nil
 }
 
+// CloneRequestBody reads the whole body into memory.
+//
+// Deprecated: use CaptureRequestBody, it limits captured size and returns decoding errors
 func CloneRequestBody(r *http.Request) (body string) {
 	if r == nil {
 		return ""
@@ -84,12 +146,12 @@ func CloneRequestBody(r *http.Request) (body string) {
 	// read body
 	bodyContent, err := io.ReadAll(bodyRC)
 	if err != nil {
-		logrus.Warnf("error reading request body: %v", err)
+		httpLog.Warnf("error reading request body: %v", err)
 		return ""
 	}
 	err = bodyRC.Close()
 	if err != nil {
-		logrus.Warnf("error closing request body: %v", err)
+		httpLog.Warnf("error closing request body: %v", err)
 	}
 
 	// set body for future reading
@@ -101,6 +163,9 @@ func CloneRequestBody(r *http.Request) (body string) {
 	return string(bodyContent)
 }
 
+// CloneResponseBody reads the whole body into memory.
+//
+// Deprecated: use CaptureResponseBody, it limits captured size, returns decoding errors and supports more encodings
 func CloneResponseBody(r *http.Response) (body string) {
 	if r == nil || r.Body == nil {
 		return ""
@@ -108,16 +173,16 @@ func CloneResponseBody(r *http.Response) (body string) {
 	var respBody = r.Body
 	bodyContent, err := io.ReadAll(respBody)
 	if err != nil {
-		logrus.Warnf("error reading response body: %v", err)
+		httpLog.Warnf("error reading response body: %v", err)
 	}
 	r.Body = io.NopCloser(bytes.NewReader(bodyContent))
 
 	if err := respBody.Close(); err != nil {
-		logrus.Warnf("error closing response body: %v", err)
+		httpLog.Warnf("error closing response body: %v", err)
 	}
 	if r.Header.Get(contentEncodingHeader) == contentEncodingGZIP {
 		if bodyContent, err = UnGzipBody(bodyContent); err != nil {
-			logrus.Warnf("ungzip response body error: %v", err)
+			httpLog.Warnf("ungzip response body error: %v", err)
 		}
 	}
 
@@ -136,13 +201,9 @@ func UnGzipBody(bodyContent []byte) ([]byte, error) {
 	return gzipContent, nil
 }
 
+// GetRequestIP returns client IP resolved by DefaultIPResolver
 func GetRequestIP(r *http.Request) (requestIP string) {
-	if ip := r.Header.Get(xForwardedForHeader); ip != "" {
-		requestIP = ip
-	} else {
-		requestIP, _, _ = net.SplitHostPort(r.RemoteAddr)
-	}
-	return
+	return DefaultIPResolver.ClientIP(r)
 }
 
 func SplitIPVersions(ip string) (ipv4, ipv6 string) {
@@ -185,8 +246,9 @@ func FillEmptyIP(ipv4, ipv6 string) (string, string) {
 type ContentType string
 
 const (
-	ContentTypeApplicationJSON ContentType = "application/json"
-	ContentTypeTextHTML        ContentType = "text/html"
+	ContentTypeApplicationJSON        ContentType = "application/json"
+	ContentTypeApplicationProblemJSON ContentType = "application/problem+json"
+	ContentTypeTextHTML               ContentType = "text/html"
 )
 
 func WrapForCORS(handler http.Handler) http.Handler {
@@ -6,7 +6,10 @@ import (
 	jsoniter "github.com/json-iterator/go"
 )
 
-var json = jsoniter.Config{EscapeHTML: false}.Froze()
+// JSON is jsoniter config shared by packages, HTML isn't escaped
+var JSON = jsoniter.Config{EscapeHTML: false}.Froze()
+
+var json = JSON
 
 const (
 	OnePercent Percent = 0.01
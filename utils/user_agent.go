@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/avct/uasurfer"
+)
+
+const (
+	secCHUAHeader                = "Sec-CH-UA"
+	secCHUAFullVersionListHeader = "Sec-CH-UA-Full-Version-List"
+	secCHUAMobileHeader          = "Sec-CH-UA-Mobile"
+	secCHUAPlatformHeader        = "Sec-CH-UA-Platform"
+	secCHUAPlatformVersionHeader = "Sec-CH-UA-Platform-Version"
+	secCHUAModelHeader           = "Sec-CH-UA-Model"
+
+	// maxLanguages limits parsed Accept-Language entries
+	maxLanguages = 8
+)
+
+// Language is an Accept-Language entry
+type Language struct {
+	Tag     string
+	Quality float64
+}
+
+// Brand is a browser brand from User-Agent Client Hints
+type Brand struct {
+	Name    string
+	Version string
+}
+
+// ClientHints are User-Agent Client Hints sent by Chromium based browsers
+type ClientHints struct {
+	Brands          []Brand
+	Mobile          bool
+	Platform        string
+	PlatformVersion string
+	Model           string
+}
+
+var userAgentPool = sync.Pool{New: func() any { return new(uasurfer.UserAgent) }}
+
+// parseUserAgent fills browser, OS, device and bot fields of the request
+func parseUserAgent(req *Request, uaStr string) {
+	ua := userAgentPool.Get().(*uasurfer.UserAgent)
+	defer userAgentPool.Put(ua)
+	ua.Reset()
+	uasurfer.ParseUserAgent(uaStr, ua)
+
+	req.UA = uaStr
+	req.OS = ua.OS.Name.String()
+	req.OSVersion = formatVersion(ua.OS.Version)
+	req.DeviceType = ua.DeviceType.String()
+	req.Browser = ua.Browser.Name.String()
+	req.BrowserVersion = formatVersion(ua.Browser.Version)
+	req.IsBot = ua.IsBot()
+}
+
+func formatVersion(v uasurfer.Version) string {
+	if v == (uasurfer.Version{}) {
+		return ""
+	}
+	var buf [32]byte
+	b := strconv.AppendInt(buf[:0], int64(v.Major), 10)
+	b = append(b, '.')
+	b = strconv.AppendInt(b, int64(v.Minor), 10)
+	b = append(b, '.')
+	b = strconv.AppendInt(b, int64(v.Patch), 10)
+	return string(b)
+}
+
+// ParseAcceptLanguage returns languages ordered by quality, entries with zero or invalid quality are skipped
+func ParseAcceptLanguage(header string) []Language {
+	if header == "" {
+		return nil
+	}
+	var languages []Language
+	for rest := header; rest != "" && len(languages) < maxLanguages; {
+		var entry string
+		entry, rest, _ = strings.Cut(rest, ",")
+		tag, params, _ := strings.Cut(entry, ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		quality := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			q, err := strconv.ParseFloat(params[2:], 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+			quality = q
+		}
+		if quality == 0 {
+			continue
+		}
+		if languages == nil {
+			languages = make([]Language, 0, 4)
+		}
+		languages = append(languages, Language{Tag: tag, Quality: quality})
+		// insertion sort keeps header order for equal quality
+		for i := len(languages) - 1; i > 0 && languages[i].Quality > languages[i-1].Quality; i-- {
+			languages[i], languages[i-1] = languages[i-1], languages[i]
+		}
+	}
+	return languages
+}
+
+// primaryLanguage returns lowercased primary subtag of the most preferred language
+func primaryLanguage(languages []Language) string {
+	for _, lang := range languages {
+		if lang.Tag == "*" {
+			continue
+		}
+		primary, _, _ := strings.Cut(lang.Tag, "-")
+		return strings.ToLower(primary)
+	}
+	return ""
+}
+
+// parseClientHints returns nil if the request has no client hints
+func parseClientHints(h http.Header) *ClientHints {
+	brandsHeader := h.Get(secCHUAFullVersionListHeader)
+	if brandsHeader == "" {
+		brandsHeader = h.Get(secCHUAHeader)
+	}
+	platform := h.Get(secCHUAPlatformHeader)
+	if brandsHeader == "" && platform == "" {
+		return nil
+	}
+	return &ClientHints{
+		Brands:          parseBrands(brandsHeader),
+		Mobile:          h.Get(secCHUAMobileHeader) == "?1",
+		Platform:        unquote(platform),
+		PlatformVersion: unquote(h.Get(secCHUAPlatformVersionHeader)),
+		Model:           unquote(h.Get(secCHUAModelHeader)),
+	}
+}
+
+// parseBrands parses structured header list like "Chromium";v="118", "Not=A?Brand";v="99", GREASE brands are skipped
+func parseBrands(header string) []Brand {
+	var brands []Brand
+	for rest := strings.TrimSpace(header); rest != ""; rest = strings.TrimLeft(rest, ", ") {
+		var brand Brand
+		brand.Name, rest = readQuoted(rest)
+		// parameters until the next list item
+		for strings.HasPrefix(rest, ";") {
+			var key, value string
+			key, rest = readToken(strings.TrimLeft(rest[1:], " "))
+			if strings.HasPrefix(rest, "=") {
+				value, rest = readQuoted(rest[1:])
+			}
+			if key == "v" {
+				brand.Version = value
+			}
+		}
+		if i := strings.IndexByte(rest, ','); i >= 0 {
+			rest = rest[i:]
+		} else {
+			rest = ""
+		}
+		if brand.Name != "" && !isGreaseBrand(brand.Name) {
+			brands = append(brands, brand)
+		}
+	}
+	return brands
+}
+
+func readQuoted(s string) (value, rest string) {
+	if !strings.HasPrefix(s, `"`) {
+		return readToken(s)
+	}
+	end := strings.IndexByte(s[1:], '"')
+	if end < 0 {
+		return s[1:], ""
+	}
+	return s[1 : end+1], s[end+2:]
+}
+
+func readToken(s string) (token, rest string) {
+	end := strings.IndexAny(s, ";=,")
+	if end < 0 {
+		return strings.TrimSpace(s), ""
+	}
+	return strings.TrimSpace(s[:end]), s[end:]
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// isGreaseBrand detects fake brands like "Not=A?Brand" which browsers add to prevent sniffing
+func isGreaseBrand(name string) bool {
+	return strings.Contains(name, "Not") && strings.Contains(name, "Brand")
+}
+
+// mainBrand prefers specific brand over generic Chromium
+func (ch *ClientHints) mainBrand() (Brand, bool) {
+	var found bool
+	var main Brand
+	for _, brand := range ch.Brands {
+		if !found || main.Name == "Chromium" {
+			main, found = brand, true
+		}
+	}
+	return main, found
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/einherij/enterprise/db/maxmind"
+)
+
+const chromeWindowsUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36"
+
+type geoDB struct {
+	info maxmind.Info
+	err  error
+	ip   net.IP
+}
+
+func (db *geoDB) Lookup(ip net.IP) (maxmind.Info, error) {
+	db.ip = ip
+	return db.info, db.err
+}
+
+func (db *geoDB) Close() error {
+	return nil
+}
+
+func Test_ParseAcceptLanguage(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		header    string
+		languages []Language
+	}{
+		{
+			name:   "Empty",
+			header: "",
+		},
+		{
+			name:   "QualityOrder",
+			header: "fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5",
+			languages: []Language{
+				{Tag: "fr-CH", Quality: 1},
+				{Tag: "fr", Quality: 0.9},
+				{Tag: "en", Quality: 0.8},
+				{Tag: "de", Quality: 0.7},
+				{Tag: "*", Quality: 0.5},
+			},
+		},
+		{
+			name:   "Unordered",
+			header: "de;q=0.5,en-US,ru;q=0.8,fr;q=0,es;q=bad",
+			languages: []Language{
+				{Tag: "en-US", Quality: 1},
+				{Tag: "ru", Quality: 0.8},
+				{Tag: "de", Quality: 0.5},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.languages, ParseAcceptLanguage(tt.header))
+		})
+	}
+}
+
+func Test_ParseGetRequest(t *testing.T) {
+	a := assert.New(t)
+	httpReq, err := http.NewRequest(http.MethodGet, "https://ads.example.com/pixel", nil)
+	require.NoError(t, err)
+	httpReq.RemoteAddr = "203.0.113.5:1234"
+	httpReq.Header.Set("Referer", "https://news.example.com/article?id=1")
+	httpReq.Header.Set("User-Agent", chromeWindowsUA)
+	httpReq.Header.Set("Accept-Language", "*;q=0.1, DE-de;q=0.9, en;q=0.8")
+	httpReq.Header.Set("Sec-CH-UA", `"Chromium";v="118", "Google Chrome";v="118", "Not=A?Brand";v="99"`)
+	httpReq.Header.Set("Sec-CH-UA-Full-Version-List", `"Chromium";v="118.0.5993.88", "Google Chrome";v="118.0.5993.88", " Not;A Brand";v="99.0.0.0"`)
+	httpReq.Header.Set("Sec-CH-UA-Mobile", "?0")
+	httpReq.Header.Set("Sec-CH-UA-Platform", `"Windows"`)
+	httpReq.Header.Set("Sec-CH-UA-Platform-Version", `"15.0.0"`)
+	db := &geoDB{info: maxmind.Info{Country: "DE", Region: "BE", City: "Berlin"}}
+
+	req, err := ParseGetRequest(httpReq, WithGeoIP(db))
+	require.NoError(t, err)
+	a.Equal("https://news.example.com/article", req.PageURL)
+	a.Equal("news.example.com", req.Domain)
+	a.Equal("OSWindows", req.OS)
+	a.Equal("15.0.0", req.OSVersion)
+	a.Equal("DeviceComputer", req.DeviceType)
+	a.Equal("BrowserChrome", req.Browser)
+	a.Equal("118.0.0", req.BrowserVersion)
+	a.Equal("Google Chrome", req.BrowserBrand)
+	a.Equal("118.0.5993.88", req.BrowserBrandVersion)
+	a.False(req.IsBot)
+	a.Equal("de", req.BrowserLanguage)
+	a.Len(req.Languages, 3)
+	a.Equal(&ClientHints{
+		Brands: []Brand{
+			{Name: "Chromium", Version: "118.0.5993.88"},
+			{Name: "Google Chrome", Version: "118.0.5993.88"},
+		},
+		Platform:        "Windows",
+		PlatformVersion: "15.0.0",
+	}, req.ClientHints)
+	a.Equal("203.0.113.5", req.IP)
+	a.Equal("203.0.113.5", db.ip.String())
+	a.Equal(db.info, req.Geo)
+
+	// geo is left empty if lookup fails
+	db.err = errors.New("lookup failed")
+	req, err = ParseGetRequest(httpReq, WithGeoIP(db))
+	require.NoError(t, err)
+	a.Empty(req.Geo)
+	a.Equal("203.0.113.5", req.IP)
+
+	// brand is empty without client hints
+	httpReq.Header.Del("Sec-CH-UA")
+	httpReq.Header.Del("Sec-CH-UA-Full-Version-List")
+	req, err = ParseGetRequest(httpReq)
+	require.NoError(t, err)
+	a.Equal("BrowserChrome", req.Browser)
+	a.Equal("118.0.0", req.BrowserVersion)
+	a.Empty(req.BrowserBrand)
+	a.Empty(req.BrowserBrandVersion)
+}
+
+func Test_ParseGetRequestBot(t *testing.T) {
+	httpReq, err := http.NewRequest(http.MethodGet, "https://ads.example.com/pixel", nil)
+	require.NoError(t, err)
+	httpReq.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)")
+
+	req, err := ParseGetRequest(httpReq)
+	require.NoError(t, err)
+	assert.True(t, req.IsBot)
+	assert.Equal(t, "BrowserGoogleBot", req.Browser)
+	assert.Nil(t, req.ClientHints)
+}
+
+func Benchmark_ParseGetRequest(b *testing.B) {
+	httpReq, err := http.NewRequest(http.MethodGet, "https://ads.example.com/pixel", nil)
+	require.NoError(b, err)
+	httpReq.RemoteAddr = "203.0.113.5:1234"
+	httpReq.Header.Set("Referer", "https://news.example.com/article?id=1")
+	httpReq.Header.Set("User-Agent", chromeWindowsUA)
+	httpReq.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	httpReq.Header.Set("Sec-CH-UA", `"Chromium";v="118", "Google Chrome";v="118", "Not=A?Brand";v="99"`)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = ParseGetRequest(httpReq)
+	}
+}
@@ -0,0 +1,98 @@
+package webtools
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+// breaker opens after consecutive failures, lets one probe through after timeout and closes on its success
+type breaker struct {
+	cfg   BreakerConfig
+	gauge prometheus.Gauge
+	now   func() time.Time
+
+	mux      sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(cfg BreakerConfig, gauge prometheus.Gauge) *breaker {
+	gauge.Set(float64(breakerClosed))
+	return &breaker{
+		cfg:   cfg,
+		gauge: gauge,
+		now:   time.Now,
+	}
+}
+
+// allow returns false if request must not be sent
+func (b *breaker) allow() bool {
+	if b.cfg.FailureThreshold <= 0 {
+		return true
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *breaker) record(success bool) {
+	if b.cfg.FailureThreshold <= 0 {
+		return
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.probing = false
+	if success {
+		b.failures = 0
+		b.setState(breakerClosed)
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.openedAt = b.now()
+		b.setState(breakerOpen)
+	}
+}
+
+// cancel releases probe without counting request, e.g. cancelled by the caller
+func (b *breaker) cancel() {
+	if b.cfg.FailureThreshold <= 0 {
+		return
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) setState(state breakerState) {
+	b.state = state
+	b.gauge.Set(float64(state))
+}
@@ -3,15 +3,161 @@ package webtools
 import (
 	"net/http"
 	"time"
+
+	"github.com/einherij/enterprise/logging"
+)
+
+// TransportConfig of http client, every zero value is replaced with default, negative value removes limit
+type TransportConfig struct {
+	MaxConnsPerHost     int           `mapstructure:"max_conns_per_host" default:"100"`
+	MaxIdleConns        int           `mapstructure:"max_idle_conns" default:"100000"`
+	MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host" default:"50000" validate:"min=0"`
+	IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout" default:"90s"`
+}
+
+const (
+	defaultClientTimeout    = 30 * time.Second
+	defaultMaxAttempts      = 3
+	defaultInitialBackoff   = 100 * time.Millisecond
+	defaultMaxBackoff       = 5 * time.Second
+	defaultMaxRetryAfter    = 30 * time.Second
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 30 * time.Second
 )
 
+var defaultTransportConfig = TransportConfig{
+	MaxConnsPerHost:     100,
+	MaxIdleConns:        100000,
+	MaxIdleConnsPerHost: 50000,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+type RetryConfig struct {
+	// MaxAttempts including the first one, 1 disables retries
+	MaxAttempts int `mapstructure:"max_attempts" default:"3" validate:"min=1"`
+	// InitialBackoff is doubled after every attempt up to MaxBackoff, a half of it is random jitter
+	InitialBackoff time.Duration `mapstructure:"initial_backoff" default:"100ms"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff" default:"5s"`
+	// MaxRetryAfter limits wait time requested by Retry-After header, longer waits aren't retried, negative removes limit
+	MaxRetryAfter time.Duration `mapstructure:"max_retry_after" default:"30s"`
+}
+
+type BreakerConfig struct {
+	// FailureThreshold is number of consecutive failures opening breaker, negative disables breaker
+	FailureThreshold int `mapstructure:"failure_threshold" default:"5"`
+	// OpenTimeout is time after which breaker lets a probe request through
+	OpenTimeout time.Duration `mapstructure:"open_timeout" default:"30s"`
+}
+
+// ClientConfig of http client, zero values are replaced with defaults, negative timeout disables it
+type ClientConfig struct {
+	// Timeout of the whole request including retries
+	Timeout   time.Duration   `mapstructure:"timeout" default:"30s"`
+	Transport TransportConfig `mapstructure:"transport"`
+	Retry     RetryConfig     `mapstructure:"retry"`
+	Breaker   BreakerConfig   `mapstructure:"breaker"`
+	// MaxConcurrentPerHost limits in-flight requests to a host, zero means no limit
+	MaxConcurrentPerHost int `mapstructure:"max_concurrent_per_host" validate:"min=0"`
+}
+
+func (c *TransportConfig) setDefaults() {
+	c.MaxConnsPerHost = intOrDefault(c.MaxConnsPerHost, defaultTransportConfig.MaxConnsPerHost)
+	c.MaxIdleConns = intOrDefault(c.MaxIdleConns, defaultTransportConfig.MaxIdleConns)
+	if c.MaxIdleConnsPerHost <= 0 {
+		c.MaxIdleConnsPerHost = defaultTransportConfig.MaxIdleConnsPerHost
+	}
+	c.IdleConnTimeout = durationOrDefault(c.IdleConnTimeout, defaultTransportConfig.IdleConnTimeout)
+}
+
+// intOrDefault returns default for zero and 0 meaning no limit for negative values
+func intOrDefault(n, def int) int {
+	switch {
+	case n == 0:
+		return def
+	case n < 0:
+		return 0
+	default:
+		return n
+	}
+}
+
+func (c *ClientConfig) setDefaults() {
+	c.Transport.setDefaults()
+	c.Timeout = durationOrDefault(c.Timeout, defaultClientTimeout)
+	if c.Retry.MaxAttempts <= 0 {
+		c.Retry.MaxAttempts = defaultMaxAttempts
+	}
+	if c.Retry.InitialBackoff <= 0 {
+		c.Retry.InitialBackoff = defaultInitialBackoff
+	}
+	if c.Retry.MaxBackoff <= 0 {
+		c.Retry.MaxBackoff = defaultMaxBackoff
+	}
+	if c.Retry.MaxBackoff < c.Retry.InitialBackoff {
+		c.Retry.MaxBackoff = c.Retry.InitialBackoff
+	}
+	c.Retry.MaxRetryAfter = durationOrDefault(c.Retry.MaxRetryAfter, defaultMaxRetryAfter)
+	if c.Breaker.FailureThreshold == 0 {
+		c.Breaker.FailureThreshold = defaultFailureThreshold
+	}
+	if c.Breaker.OpenTimeout <= 0 {
+		c.Breaker.OpenTimeout = defaultOpenTimeout
+	}
+}
+
 func NewHighLoadClient(requestTimeout time.Duration) *http.Client {
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	transport.MaxConnsPerHost = 100
-	transport.MaxIdleConns = 100000
-	transport.MaxIdleConnsPerHost = 50000
 	return &http.Client{
-		Transport: transport,
+		Transport: newTransport(defaultTransportConfig),
 		Timeout:   requestTimeout,
 	}
 }
+
+func newTransport(cfg TransportConfig) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	return transport
+}
+
+// ClientOption configures client created by NewClient
+type ClientOption func(t *resilientTransport)
+
+// WithClientLogger sets client logger, by default logger of "<name>_client" component is used
+func WithClientLogger(logger logging.Logger) ClientOption {
+	return func(t *resilientTransport) {
+		t.log = logger
+	}
+}
+
+// WithBaseTransport replaces tuned http.Transport with the given round tripper
+func WithBaseTransport(base http.RoundTripper) ClientOption {
+	return func(t *resilientTransport) {
+		t.base = base
+	}
+}
+
+var _ HTTPClient = (*http.Client)(nil)
+
+// NewClient returns client which retries idempotent requests, limits concurrency and breaks circuit per host.
+// Name is used as client label of metrics.
+func NewClient(name string, cfg ClientConfig, opts ...ClientOption) *http.Client {
+	cfg.setDefaults()
+	t := &resilientTransport{
+		name:  name,
+		cfg:   cfg,
+		log:   logging.Component(name + "_client"),
+		hosts: make(map[string]*hostState),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.base == nil {
+		t.base = newTransport(cfg.Transport)
+	}
+	return &http.Client{
+		Transport: t,
+		Timeout:   cfg.Timeout,
+	}
+}
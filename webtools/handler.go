@@ -0,0 +1,98 @@
+package webtools
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/einherij/enterprise/logging"
+	"github.com/einherij/enterprise/utils"
+)
+
+var handlerLog = logging.Component("http_handler")
+
+// Validator is implemented by request types which check their values
+type Validator interface {
+	Validate() error
+}
+
+// JSON adapts typed function to http handler.
+// Request is decoded from JSON body and from query tags, then validated if it implements Validator.
+// Response is encoded as JSON with status 200 or status of StatusCoder response, invalid status is replaced with 500.
+// Errors are written as problem+json with status of StatusCoder error, other errors are 500 and logged.
+func JSON[Req, Resp any](handle func(ctx context.Context, req Req) (Resp, error)) http.Handler {
+	var (
+		reqType   = reflect.TypeOf((*Req)(nil)).Elem()
+		isPointer = reqType.Kind() == reflect.Pointer
+	)
+	if isPointer {
+		reqType = reqType.Elem()
+	}
+	var decodeQuery = reqType.Kind() == reflect.Struct
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		// pointer request is decoded into new value, so decoders and Validator see the declared type
+		var target any = &req
+		if isPointer {
+			req = reflect.New(reqType).Interface().(Req)
+			target = req
+		}
+		if err := decodeRequest(r, target, decodeQuery); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		resp, err := handle(r.Context(), req)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		status := http.StatusOK
+		if coder, ok := any(resp).(StatusCoder); ok {
+			status = validStatus(coder.StatusCode())
+		}
+		utils.SetContentTypeHeader(w, utils.ContentTypeApplicationJSON)
+		w.WriteHeader(status)
+		if err = utils.JSON.NewEncoder(w).Encode(resp); err != nil {
+			handlerLog.Warnf("error writing response of %s %s: %v", r.Method, r.URL.Path, err)
+		}
+	})
+}
+
+func decodeRequest(r *http.Request, req any, decodeQuery bool) error {
+	if r.Body != nil && r.Body != http.NoBody {
+		err := utils.JSON.NewDecoder(r.Body).Decode(req)
+		if err != nil && !errors.Is(err, io.EOF) {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return NewHTTPError(http.StatusRequestEntityTooLarge, "request body is too large")
+			}
+			return NewHTTPError(http.StatusBadRequest, "invalid request body: %w", err)
+		}
+	}
+	if decodeQuery {
+		if err := utils.NewQueryDecoder(r.URL.Query()).DecodeQuery(req); err != nil {
+			return NewHTTPError(http.StatusBadRequest, "invalid query: %w", err)
+		}
+	}
+	if validator, ok := req.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			var coder StatusCoder
+			if errors.As(err, &coder) {
+				return err
+			}
+			return &HTTPError{Status: http.StatusUnprocessableEntity, Detail: err.Error(), Err: err}
+		}
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	problem := ProblemFromError(err)
+	if problem.Status >= http.StatusInternalServerError {
+		handlerLog.Errorf("error handling %s %s: %v", r.Method, r.URL.Path, err)
+	}
+	WriteProblem(w, r, problem)
+}
@@ -0,0 +1,148 @@
+package webtools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type createItemRequest struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Shard string `query:"shard"`
+}
+
+func (r *createItemRequest) Validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+type createItemResponse struct {
+	ID    string `json:"id"`
+	Shard string `json:"shard"`
+}
+
+func (createItemResponse) StatusCode() int {
+	return http.StatusCreated
+}
+
+var errItemExists = errors.New("item exists")
+
+type statusResponse struct {
+	Status int `json:"-"`
+}
+
+func (r statusResponse) StatusCode() int {
+	return r.Status
+}
+
+type HandlerSuite struct {
+	suite.Suite
+
+	handler http.Handler
+}
+
+func TestHandlerSuite(t *testing.T) {
+	suite.Run(t, new(HandlerSuite))
+}
+
+func (s *HandlerSuite) SetupTest() {
+	s.handler = JSON(func(ctx context.Context, req createItemRequest) (createItemResponse, error) {
+		switch req.Name {
+		case "exists":
+			return createItemResponse{}, NewHTTPError(http.StatusConflict, "item %q: %w", req.Name, errItemExists)
+		case "broken":
+			return createItemResponse{}, errors.New("database password is wrong")
+		}
+		return createItemResponse{ID: fmt.Sprintf("%s-%d", req.Name, req.Count), Shard: req.Shard}, nil
+	})
+}
+
+func (s *HandlerSuite) serve(body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items?shard=eu", strings.NewReader(body)))
+	return w
+}
+
+func (s *HandlerSuite) TestSuccess() {
+	w := s.serve(`{"name":"<item>","count":2}`)
+	s.Equal(http.StatusCreated, w.Code)
+	s.Equal("application/json", w.Header().Get("Content-Type"))
+	s.JSONEq(`{"id":"<item>-2","shard":"eu"}`, w.Body.String())
+	s.Contains(w.Body.String(), "<item>")
+}
+
+func (s *HandlerSuite) TestInvalidBody() {
+	w := s.serve(`{"name":`)
+	s.Equal(http.StatusBadRequest, w.Code)
+	s.Equal("application/problem+json", w.Header().Get("Content-Type"))
+	s.Contains(w.Body.String(), `"status":400`)
+	s.Contains(w.Body.String(), `"instance":"/items"`)
+}
+
+func (s *HandlerSuite) TestValidation() {
+	w := s.serve(`{"count":2}`)
+	s.Equal(http.StatusUnprocessableEntity, w.Code)
+	s.JSONEq(`{"title":"Unprocessable Entity","status":422,"detail":"name is required","instance":"/items"}`, w.Body.String())
+}
+
+func (s *HandlerSuite) TestTypedError() {
+	w := s.serve(`{"name":"exists"}`)
+	s.Equal(http.StatusConflict, w.Code)
+	s.JSONEq(`{"title":"Conflict","status":409,"detail":"item \"exists\": item exists","instance":"/items"}`, w.Body.String())
+}
+
+func (s *HandlerSuite) TestInternalError() {
+	w := s.serve(`{"name":"broken"}`)
+	s.Equal(http.StatusInternalServerError, w.Code)
+	s.NotContains(w.Body.String(), "password")
+}
+
+func (s *HandlerSuite) TestInvalidStatus() {
+	s.handler = JSON(func(ctx context.Context, req createItemRequest) (statusResponse, error) {
+		if req.Name == "error" {
+			return statusResponse{}, NewHTTPError(0, "no status")
+		}
+		return statusResponse{Status: 1000}, nil
+	})
+
+	w := s.serve(`{"name":"item"}`)
+	s.Equal(http.StatusInternalServerError, w.Code)
+
+	w = s.serve(`{"name":"error"}`)
+	s.Equal(http.StatusInternalServerError, w.Code)
+	s.Contains(w.Body.String(), `"status":500`)
+
+	w = httptest.NewRecorder()
+	WriteProblem(w, nil, Problem{Status: 42})
+	s.Equal(http.StatusInternalServerError, w.Code)
+	s.JSONEq(`{"title":"Internal Server Error","status":500}`, w.Body.String())
+}
+
+func (s *HandlerSuite) TestPointerRequest() {
+	s.handler = JSON(func(ctx context.Context, req *createItemRequest) (createItemResponse, error) {
+		return createItemResponse{ID: fmt.Sprintf("%s-%d", req.Name, req.Count), Shard: req.Shard}, nil
+	})
+
+	w := s.serve(`{"name":"item","count":2}`)
+	s.Equal(http.StatusCreated, w.Code)
+	s.JSONEq(`{"id":"item-2","shard":"eu"}`, w.Body.String())
+
+	w = s.serve(`{"count":2}`)
+	s.Equal(http.StatusUnprocessableEntity, w.Code)
+	s.Contains(w.Body.String(), "name is required")
+}
+
+func (s *HandlerSuite) TestHTTPErrorUnwrap() {
+	err := NewHTTPError(http.StatusNotFound, "item: %w", errItemExists)
+	s.ErrorIs(err, errItemExists)
+	s.Equal(http.StatusNotFound, ProblemFromError(fmt.Errorf("wrapped: %w", err)).Status)
+}
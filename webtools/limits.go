@@ -0,0 +1,99 @@
+package webtools
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	openConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_server_open_connections",
+		Help: "Number of open connections accepted by limited listener.",
+	}, []string{"server"})
+	rejectedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_server_rejected_requests_total",
+		Help: "Number of requests rejected because of in-flight requests limit.",
+	}, []string{"server"})
+)
+
+// limitListener blocks Accept while max connections are open
+type limitListener struct {
+	net.Listener
+	sem   chan struct{}
+	done  chan struct{}
+	once  sync.Once
+	gauge prometheus.Gauge
+}
+
+func newLimitListener(server string, ln net.Listener, maxConnections int) net.Listener {
+	return &limitListener{
+		Listener: ln,
+		sem:      make(chan struct{}, maxConnections),
+		done:     make(chan struct{}),
+		gauge:    openConnections.WithLabelValues(server),
+	}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	l.gauge.Inc()
+	return &limitConn{Conn: conn, release: l.release}, nil
+}
+
+func (l *limitListener) release() {
+	l.gauge.Dec()
+	<-l.sem
+}
+
+func (l *limitListener) Close() error {
+	err := l.Listener.Close()
+	l.once.Do(func() { close(l.done) })
+	return err
+}
+
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// limitInFlight responds with 503 Service Unavailable when max requests are already being handled
+func limitInFlight(server string, handler http.Handler, maxInFlight int, retryAfter time.Duration) http.Handler {
+	var (
+		sem      = make(chan struct{}, maxInFlight)
+		rejected = rejectedRequests.WithLabelValues(server)
+		seconds  = strconv.Itoa(int((retryAfter + time.Second - 1) / time.Second))
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			handler.ServeHTTP(w, r)
+		default:
+			rejected.Inc()
+			w.Header().Set("Retry-After", seconds)
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package webtools
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type LimitsSuite struct {
+	suite.Suite
+}
+
+func TestLimitsSuite(t *testing.T) {
+	suite.Run(t, new(LimitsSuite))
+}
+
+func (s *LimitsSuite) TestConfigDefaults() {
+	cfg := ServerConfig{Port: "0", WriteTimeout: -1, IdleTimeout: time.Minute}
+	cfg.setDefaults()
+	s.Equal(defaultReadHeaderTimeout, cfg.ReadHeaderTimeout)
+	s.Equal(defaultReadTimeout, cfg.ReadTimeout)
+	s.Equal(time.Duration(0), cfg.WriteTimeout)
+	s.Equal(time.Minute, cfg.IdleTimeout)
+	s.Equal(defaultMaxHeaderBytes, cfg.MaxHeaderBytes)
+	s.Equal(defaultShutdownTimeout, cfg.ShutdownTimeout)
+}
+
+func (s *LimitsSuite) TestServerTimeouts() {
+	server, err := NewServerWithConfig("timeouts", ServerConfig{Port: "0", ReadTimeout: time.Second}, http.NotFoundHandler())
+	s.Require().NoError(err)
+	defer server.listener.Close()
+
+	httpServer := server.server.(*http.Server)
+	s.Equal(time.Second, httpServer.ReadTimeout)
+	s.Equal(defaultReadHeaderTimeout, httpServer.ReadHeaderTimeout)
+	s.Equal(defaultMaxHeaderBytes, httpServer.MaxHeaderBytes)
+	s.Equal(defaultShutdownTimeout, server.shutdownTimeout)
+}
+
+func (s *LimitsSuite) TestLimitInFlight() {
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	handler := limitInFlight("in_flight", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}), 1, 1500*time.Millisecond)
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	<-started
+
+	rejected := httptest.NewRecorder()
+	handler.ServeHTTP(rejected, httptest.NewRequest(http.MethodGet, "/", nil))
+	s.Equal(http.StatusServiceUnavailable, rejected.Code)
+	s.Equal("2", rejected.Header().Get("Retry-After"))
+
+	close(release)
+	<-done
+	s.Equal(http.StatusOK, first.Code)
+}
+
+func (s *LimitsSuite) TestLimitListener() {
+	server, err := NewServerWithConfig("max_connections", ServerConfig{Port: "0", MaxConnections: 1}, http.NotFoundHandler())
+	s.Require().NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Run(ctx)
+
+	first, err := net.Dial("tcp", server.Addr().String())
+	s.Require().NoError(err)
+
+	second, err := net.Dial("tcp", server.Addr().String())
+	s.Require().NoError(err)
+	defer second.Close()
+	_, err = second.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	s.Require().NoError(err)
+
+	// second connection waits in backlog until the first one is closed
+	s.Require().NoError(second.SetReadDeadline(time.Now().Add(100 * time.Millisecond)))
+	_, err = second.Read(make([]byte, 1))
+	var netErr net.Error
+	s.Require().ErrorAs(err, &netErr)
+	s.True(netErr.Timeout())
+
+	s.NoError(first.Close())
+	s.Require().NoError(second.SetReadDeadline(time.Now().Add(time.Second)))
+	resp, err := http.ReadResponse(bufio.NewReader(second), nil)
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+	s.Equal(http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/einherij/enterprise/logging"
+)
+
+// AccessLog logs every handled request with its status, size and duration
+func AccessLog(logger logging.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := wrapResponseWriter(w)
+			next.ServeHTTP(rw, r)
+
+			fields := logrus.Fields{
+				"method":   r.Method,
+				"path":     r.URL.Path,
+				"status":   rw.Status(),
+				"bytes":    rw.written,
+				"duration": time.Since(start).String(),
+				"remote":   r.RemoteAddr,
+			}
+			if id := RequestIDFromContext(r.Context()); id != "" {
+				fields["request_id"] = id
+			}
+			logger.WithFields(fields).Info("request handled")
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const unmatchedRoute = "unmatched"
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_server_requests_total",
+		Help: "Number of handled http requests.",
+	}, []string{"route", "method", "status"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_server_request_duration_seconds",
+		Help:    "Duration of handled http requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	requestsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_server_requests_in_flight",
+		Help: "Number of http requests being handled.",
+	}, []string{"route"})
+)
+
+// Metrics records count, latency and in-flight requests with the given route label
+func Metrics(route string) Middleware {
+	return MetricsFunc(func(*http.Request) string { return route })
+}
+
+// MetricsFunc records count, latency and in-flight requests with route label returned by route func.
+// Route must have low cardinality, so use patterns instead of request paths.
+func MetricsFunc(route func(r *http.Request) string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			routeName := route(r)
+			inFlight := requestsInFlight.WithLabelValues(routeName)
+			inFlight.Inc()
+			defer inFlight.Dec()
+
+			start := time.Now()
+			rw := wrapResponseWriter(w)
+			next.ServeHTTP(rw, r)
+
+			status := strconv.Itoa(rw.Status())
+			requestsTotal.WithLabelValues(routeName, r.Method, status).Inc()
+			requestDuration.WithLabelValues(routeName, r.Method, status).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// MuxRoute returns route func which uses pattern of mux handler as route
+func MuxRoute(mux *http.ServeMux) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			return pattern
+		}
+		return unmatchedRoute
+	}
+}
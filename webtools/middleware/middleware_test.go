@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/suite"
+)
+
+type MiddlewareSuite struct {
+	suite.Suite
+}
+
+func TestMiddlewareSuite(t *testing.T) {
+	suite.Run(t, new(MiddlewareSuite))
+}
+
+func (s *MiddlewareSuite) TestChainOrder() {
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	}), mw("first"), mw("second"))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	s.Equal([]string{"first", "second", "handler"}, calls)
+}
+
+func (s *MiddlewareSuite) TestRequestID() {
+	var fromCtx string
+	handler := RequestID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fromCtx = RequestIDFromContext(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	s.Len(fromCtx, 32)
+	s.Equal(fromCtx, w.Header().Get(RequestIDHeader))
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(RequestIDHeader, "incoming")
+	handler.ServeHTTP(w, r)
+	s.Equal("incoming", fromCtx)
+	s.Equal("incoming", w.Header().Get(RequestIDHeader))
+
+	// unsafe id is replaced
+	for _, id := range []string{"line\nbreak", "with space", "<script>", strings.Repeat("a", 129)} {
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(RequestIDHeader, id)
+		handler.ServeHTTP(w, r)
+		s.Len(fromCtx, 32, id)
+		s.Equal(fromCtx, w.Header().Get(RequestIDHeader))
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(RequestIDHeader, "trace-1.a_B")
+	handler.ServeHTTP(w, r)
+	s.Equal("trace-1.a_B", fromCtx)
+}
+
+func (s *MiddlewareSuite) TestRecovery() {
+	logger, hook := logtest.NewNullLogger()
+	handler := Recovery(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	s.NotPanics(func() {
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	s.Equal(http.StatusInternalServerError, w.Code)
+	s.Require().NotNil(hook.LastEntry())
+	s.Equal(logrus.ErrorLevel, hook.LastEntry().Level)
+	s.Contains(hook.LastEntry().Message, "boom")
+}
+
+func (s *MiddlewareSuite) TestAccessLog() {
+	logger, hook := logtest.NewNullLogger()
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	}), RequestID(), AccessLog(logger))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/items", nil))
+	entry := hook.LastEntry()
+	s.Require().NotNil(entry)
+	s.Equal(http.MethodPost, entry.Data["method"])
+	s.Equal("/items", entry.Data["path"])
+	s.Equal(http.StatusCreated, entry.Data["status"])
+	s.Equal(int64(7), entry.Data["bytes"])
+	s.NotEmpty(entry.Data["request_id"])
+}
+
+func (s *MiddlewareSuite) TestMetrics() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics_test/", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad", http.StatusBadRequest)
+	})
+	handler := MetricsFunc(MuxRoute(mux))(mux)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics_test/1", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics_test/2", nil))
+
+	s.Equal(2.0, testutil.ToFloat64(requestsTotal.WithLabelValues("/metrics_test/", http.MethodGet, "400")))
+	s.Equal(0.0, testutil.ToFloat64(requestsInFlight.WithLabelValues("/metrics_test/")))
+	s.Equal(1, testutil.CollectAndCount(requestDuration.MustCurryWith(map[string]string{"route": "/metrics_test/"})))
+}
+
+func (s *MiddlewareSuite) TestGzip() {
+	body := strings.Repeat("compressible ", 100)
+	handler := Gzip(gzip.DefaultCompression)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1300")
+		_, _ = w.Write([]byte(body))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "br, gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	s.Equal("gzip", w.Header().Get("Content-Encoding"))
+	s.Empty(w.Header().Get("Content-Length"))
+	s.Equal("Accept-Encoding", w.Header().Get("Vary"))
+	zr, err := gzip.NewReader(w.Body)
+	s.Require().NoError(err)
+	uncompressed, err := io.ReadAll(zr)
+	s.Require().NoError(err)
+	s.Equal(body, string(uncompressed))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	s.Empty(w.Header().Get("Content-Encoding"))
+	s.Equal(body, w.Body.String())
+}
+
+func (s *MiddlewareSuite) TestGzipDetectsContentType() {
+	handler := Gzip(gzip.DefaultCompression)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("<html><body>created</body></html>"))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	s.Equal(http.StatusCreated, w.Code)
+	s.Equal("gzip", w.Header().Get("Content-Encoding"))
+	s.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+func (s *MiddlewareSuite) TestGzipQuality() {
+	for header, accepted := range map[string]bool{
+		"gzip":             true,
+		"gzip;q=0.5":       true,
+		"br, gzip; q=1.0":  true,
+		"gzip;q=0":         false,
+		"gzip;q=0.0":       false,
+		"gzip; q=0.000":    false,
+		"gzip;q=invalid":   false,
+		"deflate, br;q=1":  false,
+		"gzip;level=1;q=0": false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", header)
+		s.Equal(accepted, acceptsGzip(r), header)
+	}
+}
+
+func (s *MiddlewareSuite) TestGzipHijack() {
+	server := httptest.NewServer(Gzip(gzip.DefaultCompression)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hijacker, ok := w.(http.Hijacker)
+		if !s.True(ok) {
+			return
+		}
+		conn, rw, err := hijacker.Hijack()
+		if !s.NoError(err) {
+			return
+		}
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		_ = rw.Flush()
+	})))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	s.Equal("hijacked", string(body))
+}
+
+func (s *MiddlewareSuite) TestBodyLimit() {
+	handler := BodyLimit(4)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("small")))
+	s.Equal(http.StatusRequestEntityTooLarge, w.Code)
+
+	r := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(bytes.NewReader([]byte("chunked body"))))
+	r.ContentLength = -1
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	s.Equal(http.StatusRequestEntityTooLarge, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("ok")))
+	s.Equal(http.StatusOK, w.Code)
+}
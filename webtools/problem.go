@@ -0,0 +1,100 @@
+package webtools
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/einherij/enterprise/utils"
+)
+
+// Problem is RFC 7807 problem details
+type Problem struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// StatusCoder is implemented by errors and responses which define http status
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// HTTPError is an error with http status, its message is sent to client as problem detail
+type HTTPError struct {
+	Status int
+	Type   string
+	Detail string
+	Err    error
+}
+
+var _ StatusCoder = (*HTTPError)(nil)
+
+// NewHTTPError creates error with status and formatted detail, %w wraps error
+func NewHTTPError(status int, format string, args ...any) *HTTPError {
+	err := fmt.Errorf(format, args...)
+	return &HTTPError{
+		Status: status,
+		Detail: err.Error(),
+		Err:    errors.Unwrap(err),
+	}
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, http.StatusText(e.Status), e.Detail)
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HTTPError) StatusCode() int {
+	return e.Status
+}
+
+// validStatus replaces status which can't be written by net/http with 500
+func validStatus(status int) int {
+	if status < 100 || status > 599 {
+		return http.StatusInternalServerError
+	}
+	return status
+}
+
+// ProblemFromError returns problem with status of StatusCoder in error chain, invalid status is replaced with 500.
+// Other errors are 500 Internal Server Error without details, so internals are not exposed.
+func ProblemFromError(err error) Problem {
+	var coder StatusCoder
+	if !errors.As(err, &coder) {
+		return Problem{
+			Title:  http.StatusText(http.StatusInternalServerError),
+			Status: http.StatusInternalServerError,
+		}
+	}
+	status := validStatus(coder.StatusCode())
+	problem := Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: err.Error(),
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		problem.Type = httpErr.Type
+		problem.Detail = httpErr.Detail
+	}
+	return problem
+}
+
+// WriteProblem writes problem as application/problem+json, invalid status is replaced with 500
+func WriteProblem(w http.ResponseWriter, r *http.Request, problem Problem) {
+	if problem.Instance == "" && r != nil {
+		problem.Instance = r.URL.Path
+	}
+	if status := validStatus(problem.Status); status != problem.Status {
+		problem.Status, problem.Title = status, http.StatusText(status)
+	}
+	utils.SetContentTypeHeader(w, utils.ContentTypeApplicationProblemJSON)
+	w.WriteHeader(problem.Status)
+	_ = utils.JSON.NewEncoder(w).Encode(problem)
+}
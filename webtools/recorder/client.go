@@ -0,0 +1,327 @@
+package recorder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/einherij/enterprise/utils"
+	"github.com/einherij/enterprise/webtools"
+)
+
+type Mode string
+
+const (
+	// ModeRecord sends requests and records exchanges
+	ModeRecord Mode = "record"
+	// ModeReplay serves recorded responses without sending requests
+	ModeReplay Mode = "replay"
+	// ModeCompare sends requests and compares responses with recorded ones
+	ModeCompare Mode = "compare"
+)
+
+// Mismatch is a difference between live and recorded exchange found in compare mode
+type Mismatch struct {
+	Method string
+	URL    string
+	Diffs  utils.Diffs
+}
+
+// Client records, replays or compares exchanges of the wrapped client
+type Client struct {
+	client   webtools.HTTPClient
+	mode     Mode
+	recorder *Recorder
+	cassette *Cassette
+
+	ignoredPaths map[string]struct{}
+	onMismatch   func(Mismatch)
+	maxBodySize  int
+
+	mux        sync.Mutex
+	mismatches []Mismatch
+}
+
+var _ webtools.HTTPClient = (*Client)(nil)
+
+// ClientOption configures Client
+type ClientOption func(c *Client)
+
+// IgnorePaths skips JSON paths like "data.0.id" in compare mode, e.g. for timestamps and generated ids
+func IgnorePaths(paths ...string) ClientOption {
+	return func(c *Client) {
+		for _, path := range paths {
+			c.ignoredPaths[path] = struct{}{}
+		}
+	}
+}
+
+// OnMismatch is called for every exchange which differs from recording in compare mode
+func OnMismatch(f func(Mismatch)) ClientOption {
+	return func(c *Client) {
+		c.onMismatch = f
+	}
+}
+
+// MaxBodySize limits compared size of response bodies in compare mode, 1MB by default
+func MaxBodySize(size int) ClientOption {
+	return func(c *Client) {
+		c.maxBodySize = size
+	}
+}
+
+// NewRecordingClient records exchanges of the client, exchange is recorded when response body is read or closed
+func NewRecordingClient(client webtools.HTTPClient, recorder *Recorder) *Client {
+	return &Client{client: client, mode: ModeRecord, recorder: recorder}
+}
+
+// NewReplayClient serves responses from the cassette, not recorded requests return ErrNotRecorded
+func NewReplayClient(cassette *Cassette) *Client {
+	return &Client{mode: ModeReplay, cassette: cassette}
+}
+
+// NewComparingClient sends requests with the client and compares responses with the cassette,
+// response is compared when its body is read or closed
+func NewComparingClient(client webtools.HTTPClient, cassette *Cassette, opts ...ClientOption) *Client {
+	c := &Client{
+		client:       client,
+		mode:         ModeCompare,
+		cassette:     cassette,
+		ignoredPaths: make(map[string]struct{}),
+		maxBodySize:  defaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Mismatches returns differences found in compare mode
+func (c *Client) Mismatches() []Mismatch {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return append([]Mismatch(nil), c.mismatches...)
+}
+
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	switch c.mode {
+	case ModeReplay:
+		exchange, err := c.cassette.Next(req.Method, req.URL.String())
+		if err != nil {
+			return nil, err
+		}
+		return recordedResponse(req, exchange.Response)
+	case ModeCompare:
+		return c.compare(req)
+	default:
+		return c.record(req)
+	}
+}
+
+func (c *Client) record(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	reqCapture := utils.CaptureRequestBody(req, c.recorder.maxBodySize)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		reqCapture.Release()
+		return nil, err
+	}
+	url := req.URL.String()
+	err = captureBody(resp, c.recorder.maxBodySize, func(respCapture *utils.BodyCapture) error {
+		defer reqCapture.Release()
+		exchange, err := c.recorder.exchange(start, req, url, reqCapture, resp.StatusCode, resp.Header, respCapture)
+		if err != nil {
+			return fmt.Errorf("error recording exchange: %w", err)
+		}
+		return c.recorder.Record(exchange)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) compare(req *http.Request) (*http.Response, error) {
+	recorded, err := c.cassette.Next(req.Method, req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	url := req.URL.String()
+	err = captureBody(resp, c.maxBodySize, func(capture *utils.BodyCapture) error {
+		live, err := newBody(capture)
+		if err != nil {
+			return fmt.Errorf("error decoding response body: %w", err)
+		}
+		c.compareResponse(Mismatch{Method: req.Method, URL: url}, recorded.Response, resp.StatusCode, live)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) compareResponse(mismatch Mismatch, recorded Response, status int, live Body) {
+	if status != recorded.Status {
+		mismatch.Diffs = append(mismatch.Diffs, utils.Diff{
+			Path:  "status",
+			Left:  strconv.Itoa(recorded.Status),
+			Right: strconv.Itoa(status),
+			Error: utils.ErrValuesDontMatch,
+		})
+	}
+	mismatch.Diffs = append(mismatch.Diffs, c.compareBodies(recorded.Body.Content, live.Content)...)
+	if len(mismatch.Diffs) == 0 {
+		return
+	}
+	c.mux.Lock()
+	c.mismatches = append(c.mismatches, mismatch)
+	c.mux.Unlock()
+	if c.onMismatch != nil {
+		c.onMismatch(mismatch)
+	}
+}
+
+// compareBodies compares JSON bodies by values and other bodies as strings
+func (c *Client) compareBodies(recorded, live string) utils.Diffs {
+	if recorded == live {
+		return nil
+	}
+	diffs, err := utils.CompareJSON(recorded, live)
+	if err != nil {
+		return utils.Diffs{{Path: "body", Left: recorded, Right: live, Error: utils.ErrValuesDontMatch}}
+	}
+	var filtered utils.Diffs
+	for _, diff := range diffs {
+		if _, ok := c.ignoredPaths[diff.Path]; !ok {
+			filtered = append(filtered, diff)
+		}
+	}
+	return filtered
+}
+
+// captureBody tees response body into capture of up to max bytes while it's read by the caller,
+// done is called with the capture when body is read to the end or closed, its error is returned by Close.
+// Response without body is passed to done at once.
+func captureBody(resp *http.Response, max int, done func(*utils.BodyCapture) error) error {
+	capture := utils.CaptureResponseBody(resp, max)
+	if resp.Body == nil || resp.Body == http.NoBody {
+		defer capture.Release()
+		return done(capture)
+	}
+	resp.Body = &capturedBody{body: resp.Body, capture: capture, max: max, done: done}
+	return nil
+}
+
+type capturedBody struct {
+	body    io.ReadCloser
+	capture *utils.BodyCapture
+	max     int
+	done    func(*utils.BodyCapture) error
+
+	finished bool
+	err      error
+}
+
+func (b *capturedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if err == io.EOF {
+		b.finish(true)
+	} else if err != nil {
+		// partial body isn't passed as complete one
+		b.finish(false)
+	}
+	return n, err
+}
+
+// Close reads the rest of body which fits into capture, so it's complete or marked truncated
+func (b *capturedBody) Close() error {
+	if !b.finished {
+		room := int64(b.max) - b.capture.Size()
+		if room < 0 {
+			room = 0
+		}
+		_, err := io.CopyN(io.Discard, b.body, room+1)
+		b.finish(err == nil || err == io.EOF)
+	}
+	return errors.Join(b.body.Close(), b.err)
+}
+
+func (b *capturedBody) finish(complete bool) {
+	if b.finished {
+		return
+	}
+	b.finished = true
+	if complete {
+		b.err = b.done(b.capture)
+	}
+	b.capture.Release()
+}
+
+func recordedResponse(req *http.Request, recorded Response) (*http.Response, error) {
+	body, err := recorded.Body.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("error decoding recorded body: %w", err)
+	}
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(recorded.Status) + " " + http.StatusText(recorded.Status),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func (c *Client) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func (c *Client) Head(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func (c *Client) Post(url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.Do(req)
+}
+
+func (c *Client) PostForm(url string, data url.Values) (*http.Response, error) {
+	return c.Post(url, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+}
+
+func (c *Client) CloseIdleConnections() {
+	if c.client != nil {
+		c.client.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,232 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/einherij/enterprise/utils"
+)
+
+const (
+	defaultMaxBodySize = 1 << 20
+
+	base64Encoding = "base64"
+	redactedValue  = "REDACTED"
+)
+
+var json = utils.JSON
+
+var defaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Exchange is a recorded request with its response, one exchange is one line of recording
+type Exchange struct {
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+	Request  Request       `json:"request"`
+	Response Response      `json:"response"`
+}
+
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body"`
+}
+
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body"`
+}
+
+// Body is decoded body, binary bodies are base64 encoded
+type Body struct {
+	Content   string `json:"content,omitempty"`
+	Encoding  string `json:"encoding,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+func newBody(capture *utils.BodyCapture) (Body, error) {
+	decoded, err := capture.Decoded()
+	if err != nil {
+		return Body{}, err
+	}
+	body := Body{Truncated: capture.Truncated()}
+	if utf8.Valid(decoded) {
+		body.Content = string(decoded)
+	} else {
+		body.Content = base64.StdEncoding.EncodeToString(decoded)
+		body.Encoding = base64Encoding
+	}
+	return body, nil
+}
+
+// Bytes returns decoded body content
+func (b Body) Bytes() ([]byte, error) {
+	if b.Encoding == base64Encoding {
+		return base64.StdEncoding.DecodeString(b.Content)
+	}
+	return []byte(b.Content), nil
+}
+
+// recordedHeader copies header without headers describing encoded body and with redacted secrets
+func recordedHeader(h http.Header, redacted []string) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	header := h.Clone()
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+	for _, name := range redacted {
+		if _, ok := header[http.CanonicalHeaderKey(name)]; ok {
+			header.Set(name, redactedValue)
+		}
+	}
+	return header
+}
+
+// Recorder writes exchanges as JSON lines
+type Recorder struct {
+	mux    sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+
+	maxBodySize     int
+	redactedHeaders []string
+}
+
+// Option configures Recorder
+type Option func(r *Recorder)
+
+// WithMaxBodySize limits recorded size of request and response bodies, 1MB by default
+func WithMaxBodySize(size int) Option {
+	return func(r *Recorder) {
+		r.maxBodySize = size
+	}
+}
+
+// WithRedactedHeaders replaces default redacted headers: Authorization, Proxy-Authorization, Cookie and Set-Cookie
+func WithRedactedHeaders(headers ...string) Option {
+	return func(r *Recorder) {
+		r.redactedHeaders = headers
+	}
+}
+
+func NewRecorder(w io.Writer, opts ...Option) *Recorder {
+	r := &Recorder{
+		w:               bufio.NewWriter(w),
+		maxBodySize:     defaultMaxBodySize,
+		redactedHeaders: defaultRedactedHeaders,
+	}
+	if closer, ok := w.(io.Closer); ok {
+		r.closer = closer
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// NewFileRecorder appends exchanges to the file
+func NewFileRecorder(path string, opts ...Option) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening recording file: %w", err)
+	}
+	return NewRecorder(file, opts...), nil
+}
+
+// Record writes exchange and flushes it
+func (r *Recorder) Record(exchange Exchange) error {
+	line, err := json.Marshal(exchange)
+	if err != nil {
+		return fmt.Errorf("error marshaling exchange: %w", err)
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, err = r.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing exchange: %w", err)
+	}
+	return r.w.Flush()
+}
+
+func (r *Recorder) Close() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	err := r.w.Flush()
+	if r.closer != nil {
+		err = errors.Join(err, r.closer.Close())
+	}
+	return err
+}
+
+// Cassette is a loaded recording, exchanges with the same method and URL are replayed in recorded order
+type Cassette struct {
+	mux       sync.Mutex
+	exchanges map[string][]Exchange
+	served    map[string]int
+}
+
+var ErrNotRecorded = errors.New("exchange is not recorded")
+
+func Load(r io.Reader) (*Cassette, error) {
+	c := &Cassette{
+		exchanges: make(map[string][]Exchange),
+		served:    make(map[string]int),
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var exchange Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &exchange); err != nil {
+			return nil, fmt.Errorf("error parsing exchange on line %d: %w", line, err)
+		}
+		key := exchangeKey(exchange.Request.Method, exchange.Request.URL)
+		c.exchanges[key] = append(c.exchanges[key], exchange)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading recording: %w", err)
+	}
+	return c, nil
+}
+
+func LoadFile(path string) (*Cassette, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening recording file: %w", err)
+	}
+	defer file.Close()
+	return Load(file)
+}
+
+// Next returns the next recorded exchange for method and URL, the last one is repeated
+func (c *Cassette) Next(method, url string) (Exchange, error) {
+	key := exchangeKey(method, url)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	exchanges := c.exchanges[key]
+	if len(exchanges) == 0 {
+		return Exchange{}, fmt.Errorf("%w: %s", ErrNotRecorded, key)
+	}
+	i := c.served[key]
+	if i >= len(exchanges) {
+		i = len(exchanges) - 1
+	}
+	c.served[key] = i + 1
+	return exchanges[i], nil
+}
+
+func exchangeKey(method, url string) string {
+	return method + " " + url
+}
@@ -0,0 +1,194 @@
+package recorder
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/einherij/enterprise/utils"
+)
+
+type RecorderSuite struct {
+	suite.Suite
+
+	responses []string
+	server    *httptest.Server
+}
+
+func TestRecorderSuite(t *testing.T) {
+	suite.Run(t, new(RecorderSuite))
+}
+
+func (s *RecorderSuite) SetupTest() {
+	s.responses = []string{`{"id":1,"name":"first","time":"10:00"}`, `{"id":2,"name":"second","time":"10:01"}`}
+	var call int
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(s.responses[call%len(s.responses)]))
+		call++
+	}))
+}
+
+func (s *RecorderSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *RecorderSuite) TestMiddlewareAndReplayHandler() {
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf)
+	handler := recorder.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(append([]byte("created "), body...))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/items?x=1", strings.NewReader("item"))
+	req.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	s.Equal("created item", w.Body.String())
+	s.NotContains(buf.String(), "token")
+	s.NotContains(buf.String(), "secret")
+
+	cassette, err := Load(&buf)
+	s.Require().NoError(err)
+	exchange, err := cassette.Next(http.MethodPost, "/items?x=1")
+	s.Require().NoError(err)
+	s.Equal("item", exchange.Request.Body.Content)
+	s.Equal(http.StatusCreated, exchange.Response.Status)
+
+	replay := ReplayHandler(cassette)
+	w = httptest.NewRecorder()
+	replay.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items?x=1", nil))
+	s.Equal(http.StatusCreated, w.Code)
+	s.Equal("created item", w.Body.String())
+
+	w = httptest.NewRecorder()
+	replay.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	s.Equal(http.StatusNotImplemented, w.Code)
+}
+
+func (s *RecorderSuite) TestRecordAndReplayClient() {
+	path := filepath.Join(s.T().TempDir(), "recording.jsonl")
+	recorder, err := NewFileRecorder(path)
+	s.Require().NoError(err)
+	client := NewRecordingClient(s.server.Client(), recorder)
+
+	for _, expected := range s.responses {
+		resp, err := client.Get(s.server.URL + "/items")
+		s.Require().NoError(err)
+		body, err := io.ReadAll(resp.Body)
+		s.NoError(err)
+		s.NoError(resp.Body.Close())
+		s.Equal(expected, string(body))
+	}
+	s.NoError(recorder.Close())
+
+	cassette, err := LoadFile(path)
+	s.Require().NoError(err)
+	replay := NewReplayClient(cassette)
+	// the last recorded response is repeated
+	for _, expected := range append(s.responses, s.responses[1]) {
+		resp, err := replay.Get(s.server.URL + "/items")
+		s.Require().NoError(err)
+		body, err := io.ReadAll(resp.Body)
+		s.NoError(err)
+		s.Equal(http.StatusOK, resp.StatusCode)
+		s.Equal("application/json", resp.Header.Get("Content-Type"))
+		s.Equal(expected, string(body))
+	}
+
+	_, err = replay.Get(s.server.URL + "/unknown")
+	s.ErrorIs(err, ErrNotRecorded)
+}
+
+func (s *RecorderSuite) TestCompareClient() {
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf)
+	client := NewRecordingClient(s.server.Client(), recorder)
+	resp, err := client.Get(s.server.URL + "/items")
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+	resp, err = client.Post(s.server.URL+"/items", "text/plain", strings.NewReader("missing"))
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+
+	cassette, err := Load(&buf)
+	s.Require().NoError(err)
+	s.responses = []string{`{"id":1,"name":"changed","time":"11:00"}`}
+	var reported []Mismatch
+	compare := NewComparingClient(s.server.Client(), cassette, IgnorePaths("time"), OnMismatch(func(m Mismatch) {
+		reported = append(reported, m)
+	}))
+
+	resp, err = compare.Get(s.server.URL + "/items")
+	s.Require().NoError(err)
+	body, err := io.ReadAll(resp.Body)
+	s.NoError(err)
+	s.Equal(s.responses[0], string(body))
+
+	resp, err = compare.Post(s.server.URL+"/items", "text/plain", strings.NewReader("missing"))
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+
+	mismatches := compare.Mismatches()
+	s.Equal(reported, mismatches)
+	s.Require().Len(mismatches, 1)
+	s.Equal(utils.Diffs{{Path: "name", Left: "first", Right: "changed", Error: utils.ErrValuesDontMatch}}, mismatches[0].Diffs)
+}
+
+func (s *RecorderSuite) TestLargeResponse() {
+	s.responses = []string{strings.Repeat("0123456789", 10000)}
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf, WithMaxBodySize(16))
+	client := NewRecordingClient(s.server.Client(), recorder)
+
+	// body is streamed to the caller and recorded when it's read
+	resp, err := client.Get(s.server.URL + "/items")
+	s.Require().NoError(err)
+	s.Zero(buf.Len())
+	body, err := io.ReadAll(resp.Body)
+	s.NoError(err)
+	s.NoError(resp.Body.Close())
+	s.Equal(s.responses[0], string(body))
+
+	// body which isn't read is recorded on close
+	resp, err = client.Get(s.server.URL + "/items")
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+
+	cassette, err := Load(bytes.NewReader(buf.Bytes()))
+	s.Require().NoError(err)
+	for i := 0; i < 2; i++ {
+		exchange, err := cassette.Next(http.MethodGet, s.server.URL+"/items")
+		s.Require().NoError(err)
+		s.Equal(Body{Content: "0123456789012345", Truncated: true}, exchange.Response.Body)
+	}
+
+	// compared bodies are limited by the same size
+	cassette, err = Load(bytes.NewReader(buf.Bytes()))
+	s.Require().NoError(err)
+	compare := NewComparingClient(s.server.Client(), cassette, MaxBodySize(16))
+	resp, err = compare.Get(s.server.URL + "/items")
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+	s.Empty(compare.Mismatches())
+
+	compare = NewComparingClient(s.server.Client(), cassette)
+	resp, err = compare.Get(s.server.URL + "/items")
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+	s.Len(compare.Mismatches(), 1)
+}
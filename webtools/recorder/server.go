@@ -0,0 +1,126 @@
+package recorder
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/einherij/enterprise/logging"
+	"github.com/einherij/enterprise/utils"
+	"github.com/einherij/enterprise/webtools/middleware"
+)
+
+var log = logging.Component("recorder")
+
+// Middleware records exchanges handled by server, URL of recorded request is its request URI
+func (r *Recorder) Middleware() middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			reqCapture := utils.CaptureRequestBody(req, r.maxBodySize)
+			defer reqCapture.Release()
+			rw := &captureWriter{ResponseWriter: w, status: http.StatusOK, max: r.maxBodySize}
+			defer func() {
+				if rw.capture != nil {
+					rw.capture.Release()
+				}
+			}()
+
+			next.ServeHTTP(rw, req)
+
+			if rw.capture == nil {
+				rw.WriteHeader(http.StatusOK)
+			}
+			exchange, err := r.exchange(start, req, req.URL.RequestURI(), reqCapture, rw.status, rw.Header(), rw.capture)
+			if err == nil {
+				err = r.Record(exchange)
+			}
+			if err != nil {
+				log.Errorf("error recording %s %s: %v", req.Method, req.URL.Path, err)
+			}
+		})
+	}
+}
+
+func (r *Recorder) exchange(start time.Time, req *http.Request, url string, reqCapture *utils.BodyCapture,
+	status int, header http.Header, respCapture *utils.BodyCapture) (Exchange, error) {
+	reqBody, err := newBody(reqCapture)
+	if err != nil {
+		return Exchange{}, err
+	}
+	respBody, err := newBody(respCapture)
+	if err != nil {
+		return Exchange{}, err
+	}
+	return Exchange{
+		Time:     start,
+		Duration: time.Since(start),
+		Request: Request{
+			Method: req.Method,
+			URL:    url,
+			Header: recordedHeader(req.Header, r.redactedHeaders),
+			Body:   reqBody,
+		},
+		Response: Response{
+			Status: status,
+			Header: recordedHeader(header, r.redactedHeaders),
+			Body:   respBody,
+		},
+	}, nil
+}
+
+// captureWriter tees response body into capture created when header is written
+type captureWriter struct {
+	http.ResponseWriter
+	status  int
+	capture *utils.BodyCapture
+	max     int
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	if w.capture != nil {
+		return
+	}
+	w.status = status
+	w.capture = utils.NewBodyCapture(w.max, w.Header().Get("Content-Encoding"))
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	if w.capture == nil {
+		w.WriteHeader(http.StatusOK)
+	}
+	_, _ = w.capture.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *captureWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ReplayHandler serves recorded responses by request method and URI.
+// Not recorded requests get 501 Not Implemented.
+func ReplayHandler(cassette *Cassette) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		exchange, err := cassette.Next(req.Method, req.URL.RequestURI())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		body, err := exchange.Response.Body.Bytes()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for k, v := range exchange.Response.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(exchange.Response.Status)
+		_, _ = w.Write(body)
+	})
+}
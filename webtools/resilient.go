@@ -0,0 +1,231 @@
+package webtools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/einherij/enterprise/logging"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+var (
+	clientRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_requests_total",
+		Help: "Number of http client request attempts by status, status is \"error\" for transport errors.",
+	}, []string{"client", "host", "method", "status"})
+	clientRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_client_request_duration_seconds",
+		Help:    "Duration of http client request attempts.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"client", "host", "method"})
+	clientRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_retries_total",
+		Help: "Number of retried http client requests.",
+	}, []string{"client", "host"})
+	clientBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_client_circuit_breaker_state",
+		Help: "State of circuit breaker per host: 0 closed, 1 half-open, 2 open.",
+	}, []string{"client", "host"})
+)
+
+type hostState struct {
+	breaker *breaker
+	sem     chan struct{}
+}
+
+type resilientTransport struct {
+	name string
+	cfg  ClientConfig
+	log  logging.Logger
+	base http.RoundTripper
+
+	mux   sync.Mutex
+	hosts map[string]*hostState
+}
+
+func (t *resilientTransport) host(host string) *hostState {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	hs, ok := t.hosts[host]
+	if !ok {
+		hs = &hostState{
+			breaker: newBreaker(t.cfg.Breaker, clientBreakerState.WithLabelValues(t.name, host)),
+		}
+		if t.cfg.MaxConcurrentPerHost > 0 {
+			hs.sem = make(chan struct{}, t.cfg.MaxConcurrentPerHost)
+		}
+		t.hosts[host] = hs
+	}
+	return hs
+}
+
+func (t *resilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var (
+		ctx       = req.Context()
+		host      = req.URL.Host
+		hs        = t.host(host)
+		canRetry  = isIdempotent(req) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+		firstBody = true
+	)
+	for attempt := 1; ; attempt++ {
+		if !hs.breaker.allow() {
+			return nil, fmt.Errorf("%w for host %s", ErrCircuitOpen, host)
+		}
+		attemptReq := req
+		if !firstBody && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("error getting request body for retry: %w", err)
+			}
+			attemptReq = req.Clone(ctx)
+			attemptReq.Body = body
+		}
+		firstBody = false
+
+		resp, err := t.roundTrip(attemptReq, hs)
+		if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+			// request cancelled by the caller says nothing about the host
+			hs.breaker.cancel()
+		} else {
+			hs.breaker.record(err == nil && resp.StatusCode < http.StatusInternalServerError)
+		}
+
+		if !canRetry || attempt >= t.cfg.Retry.MaxAttempts || ctx.Err() != nil || !shouldRetry(resp, err) {
+			return resp, err
+		}
+		wait, ok := t.retryWait(attempt, resp)
+		if !ok {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			_ = resp.Body.Close()
+		}
+		t.log.Debugf("retrying %s %s in %v after attempt %d: %v", req.Method, host, wait, attempt, describeAttempt(resp, err))
+		clientRetries.WithLabelValues(t.name, host).Inc()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// roundTrip sends single attempt holding host concurrency slot until response body is closed
+func (t *resilientTransport) roundTrip(req *http.Request, hs *hostState) (*http.Response, error) {
+	var release = func() {}
+	if hs.sem != nil {
+		select {
+		case hs.sem <- struct{}{}:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		var once sync.Once
+		release = func() { once.Do(func() { <-hs.sem }) }
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	clientRequestDuration.WithLabelValues(t.name, req.URL.Host, req.Method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		release()
+		clientRequests.WithLabelValues(t.name, req.URL.Host, req.Method, "error").Inc()
+		return nil, err
+	}
+	clientRequests.WithLabelValues(t.name, req.URL.Host, req.Method, strconv.Itoa(resp.StatusCode)).Inc()
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// isIdempotent returns true for idempotent methods and requests with Idempotency-Key header
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(idempotencyKeyHeader) != ""
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryWait returns backoff with jitter or time requested by Retry-After header
+func (t *resilientTransport) retryWait(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return wait, wait <= t.cfg.Retry.MaxRetryAfter || t.cfg.Retry.MaxRetryAfter <= 0
+		}
+	}
+	backoff := t.cfg.Retry.InitialBackoff
+	for i := 1; i < attempt && backoff < t.cfg.Retry.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > t.cfg.Retry.MaxBackoff {
+		backoff = t.cfg.Retry.MaxBackoff
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)), true
+}
+
+// parseRetryAfter parses delay in seconds or http date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+func describeAttempt(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
+}
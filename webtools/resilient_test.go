@@ -0,0 +1,253 @@
+package webtools
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+)
+
+type ResilientClientSuite struct {
+	suite.Suite
+
+	calls int32
+}
+
+func TestResilientClientSuite(t *testing.T) {
+	suite.Run(t, new(ResilientClientSuite))
+}
+
+func (s *ResilientClientSuite) SetupTest() {
+	atomic.StoreInt32(&s.calls, 0)
+}
+
+func (s *ResilientClientSuite) config() ClientConfig {
+	return ClientConfig{
+		Timeout: 5 * time.Second,
+		Retry: RetryConfig{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     5 * time.Millisecond,
+			MaxRetryAfter:  time.Second,
+		},
+	}
+}
+
+// serve responds with statuses in order, the last status is repeated
+func (s *ResilientClientSuite) serve(statuses ...int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(atomic.AddInt32(&s.calls, 1))
+		body, _ := io.ReadAll(r.Body)
+		status := statuses[len(statuses)-1]
+		if call <= len(statuses) {
+			status = statuses[call-1]
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	}))
+	s.T().Cleanup(server.Close)
+	return server
+}
+
+func (s *ResilientClientSuite) TestRetryIdempotent() {
+	server := s.serve(http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK)
+	client := NewClient("retry_idempotent", s.config())
+
+	req, err := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("payload"))
+	s.Require().NoError(err)
+	resp, err := client.Do(req)
+	s.Require().NoError(err)
+	body, err := io.ReadAll(resp.Body)
+	s.NoError(err)
+	s.NoError(resp.Body.Close())
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("payload", string(body))
+	s.EqualValues(3, atomic.LoadInt32(&s.calls))
+	s.Equal(2.0, testutil.ToFloat64(clientRetries.WithLabelValues("retry_idempotent", strings.TrimPrefix(server.URL, "http://"))))
+}
+
+func (s *ResilientClientSuite) TestNoRetryNotIdempotent() {
+	server := s.serve(http.StatusServiceUnavailable, http.StatusOK)
+	client := NewClient("no_retry", s.config())
+
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+	s.Equal(http.StatusServiceUnavailable, resp.StatusCode)
+	s.EqualValues(1, atomic.LoadInt32(&s.calls))
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("payload"))
+	s.Require().NoError(err)
+	req.Header.Set("Idempotency-Key", "key")
+	resp, err = client.Do(req)
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+	s.Equal(http.StatusOK, resp.StatusCode)
+}
+
+func (s *ResilientClientSuite) TestRetryAfter() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&s.calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	client := NewClient("retry_after", s.config())
+
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.GreaterOrEqual(time.Since(start), time.Second)
+
+	cfg := s.config()
+	cfg.Retry.MaxRetryAfter = 100 * time.Millisecond
+	atomic.StoreInt32(&s.calls, 0)
+	resp, err = NewClient("retry_after_too_long", cfg).Get(server.URL)
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+	s.Equal(http.StatusTooManyRequests, resp.StatusCode)
+}
+
+func (s *ResilientClientSuite) TestCircuitBreaker() {
+	server := s.serve(http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK)
+	cfg := s.config()
+	cfg.Retry.MaxAttempts = 1
+	cfg.Breaker = BreakerConfig{FailureThreshold: 2, OpenTimeout: 50 * time.Millisecond}
+	client := NewClient("breaker", cfg)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		s.Require().NoError(err)
+		s.NoError(resp.Body.Close())
+	}
+	_, err := client.Get(server.URL)
+	s.ErrorIs(err, ErrCircuitOpen)
+	s.EqualValues(2, atomic.LoadInt32(&s.calls))
+	s.Equal(float64(breakerOpen), testutil.ToFloat64(clientBreakerState.WithLabelValues("breaker", host)))
+
+	time.Sleep(60 * time.Millisecond)
+	resp, err := client.Get(server.URL)
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal(float64(breakerClosed), testutil.ToFloat64(clientBreakerState.WithLabelValues("breaker", host)))
+}
+
+func (s *ResilientClientSuite) TestCancelledRequestIsNotFailure() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.calls, 1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+	cfg := s.config()
+	cfg.Breaker = BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}
+	client := NewClient("breaker_cancelled", cfg)
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		s.Require().NoError(err)
+		// cancel while request is in flight
+		time.AfterFunc(10*time.Millisecond, cancel)
+		_, err = client.Do(req)
+		s.ErrorIs(err, context.Canceled)
+		cancel()
+	}
+	s.EqualValues(2, atomic.LoadInt32(&s.calls))
+	s.Equal(float64(breakerClosed), testutil.ToFloat64(clientBreakerState.WithLabelValues("breaker_cancelled", strings.TrimPrefix(server.URL, "http://"))))
+}
+
+func (s *ResilientClientSuite) TestDefaults() {
+	var cfg ClientConfig
+	cfg.setDefaults()
+	s.Equal(30*time.Second, cfg.Timeout)
+	s.Equal(3, cfg.Retry.MaxAttempts)
+	s.Equal(5*time.Second, cfg.Retry.MaxBackoff)
+	s.Equal(30*time.Second, cfg.Retry.MaxRetryAfter)
+	s.Equal(5, cfg.Breaker.FailureThreshold)
+	s.Equal(30*time.Second, cfg.Breaker.OpenTimeout)
+	s.Equal(defaultTransportConfig, cfg.Transport)
+
+	// defaults are applied to every zero field of partial config
+	cfg = ClientConfig{
+		Timeout:   -1,
+		Transport: TransportConfig{MaxConnsPerHost: -1, IdleConnTimeout: time.Minute},
+		Breaker:   BreakerConfig{FailureThreshold: -1},
+	}
+	cfg.setDefaults()
+	s.Zero(cfg.Timeout)
+	s.Equal(TransportConfig{
+		MaxConnsPerHost:     0,
+		MaxIdleConns:        100000,
+		MaxIdleConnsPerHost: 50000,
+		IdleConnTimeout:     time.Minute,
+	}, cfg.Transport)
+	s.True(newBreaker(cfg.Breaker, clientBreakerState.WithLabelValues("defaults", "host")).allow())
+}
+
+func (s *ResilientClientSuite) TestConcurrencyLimit() {
+	var (
+		inFlight, maxInFlight int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			prev := atomic.LoadInt32(&maxInFlight)
+			if current <= prev || atomic.CompareAndSwapInt32(&maxInFlight, prev, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer server.Close()
+	cfg := s.config()
+	cfg.MaxConcurrentPerHost = 2
+	client := NewClient("concurrency", cfg)
+
+	done := make(chan struct{})
+	for i := 0; i < 6; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			resp, err := client.Get(server.URL)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+		}()
+	}
+	for i := 0; i < 6; i++ {
+		<-done
+	}
+	s.LessOrEqual(atomic.LoadInt32(&maxInFlight), int32(2))
+}
+
+func (s *ResilientClientSuite) TestParseRetryAfter() {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	wait, ok := parseRetryAfter("3", now)
+	s.True(ok)
+	s.Equal(3*time.Second, wait)
+
+	wait, ok = parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now)
+	s.True(ok)
+	s.Equal(time.Minute, wait)
+
+	_, ok = parseRetryAfter("soon", now)
+	s.False(ok)
+}
@@ -3,54 +3,207 @@ package webtools
 import (
 	"context"
 	"fmt"
+	"log"
 	"net"
 	"net/http"
 	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/einherij/enterprise/logging"
+	"github.com/einherij/enterprise/webtools/middleware"
 )
 
-const shutdownTimeout = 10 * time.Second
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 60 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+	defaultMaxHeaderBytes    = 1 << 20
+	defaultShutdownTimeout   = 10 * time.Second
+	defaultRetryAfter        = time.Second
+)
 
+// ServerConfig of http server, zero values are replaced with defaults, negative timeouts disable them
 type ServerConfig struct {
-	Port string `mapstructure:"port"`
+	Port string    `mapstructure:"port" validate:"required"`
+	TLS  TLSConfig `mapstructure:"tls"`
+
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout" default:"10s"`
+	ReadTimeout       time.Duration `mapstructure:"read_timeout" default:"30s"`
+	WriteTimeout      time.Duration `mapstructure:"write_timeout" default:"60s"`
+	IdleTimeout       time.Duration `mapstructure:"idle_timeout" default:"120s"`
+	MaxHeaderBytes    int           `mapstructure:"max_header_bytes" default:"1048576" validate:"min=0"`
+	ShutdownTimeout   time.Duration `mapstructure:"shutdown_timeout" default:"10s"`
+	// MaxConnections limits concurrently open connections, zero means no limit
+	MaxConnections int `mapstructure:"max_connections" validate:"min=0"`
+	// MaxInFlight limits concurrently handled requests, others get 503 with Retry-After, zero means no limit
+	MaxInFlight int           `mapstructure:"max_in_flight" validate:"min=0"`
+	RetryAfter  time.Duration `mapstructure:"retry_after" default:"1s"`
+}
+
+func (c *ServerConfig) setDefaults() {
+	c.ReadHeaderTimeout = durationOrDefault(c.ReadHeaderTimeout, defaultReadHeaderTimeout)
+	c.ReadTimeout = durationOrDefault(c.ReadTimeout, defaultReadTimeout)
+	c.WriteTimeout = durationOrDefault(c.WriteTimeout, defaultWriteTimeout)
+	c.IdleTimeout = durationOrDefault(c.IdleTimeout, defaultIdleTimeout)
+	c.ShutdownTimeout = durationOrDefault(c.ShutdownTimeout, defaultShutdownTimeout)
+	if c.MaxHeaderBytes <= 0 {
+		c.MaxHeaderBytes = defaultMaxHeaderBytes
+	}
+	if c.RetryAfter <= 0 {
+		c.RetryAfter = defaultRetryAfter
+	}
+}
+
+func durationOrDefault(d, def time.Duration) time.Duration {
+	switch {
+	case d == 0:
+		return def
+	case d < 0:
+		return 0
+	default:
+		return d
+	}
 }
 
 type Server struct {
 	name     string
+	log      logging.Logger
 	server   HTTPServer
 	listener net.Listener
+	certs    *certReloader
+
+	shutdownTimeout time.Duration
+	handler         http.Handler
+	middlewares     []middleware.Middleware
+}
+
+// ServerOption configures Server
+type ServerOption func(s *Server)
+
+// WithLogger sets server logger, by default logger of "<name>_server" component is used
+func WithLogger(logger logging.Logger) ServerOption {
+	return func(s *Server) {
+		s.log = logger
+	}
+}
+
+// WithMiddleware wraps server handler with middlewares, the first middleware is the outermost one
+func WithMiddleware(middlewares ...middleware.Middleware) ServerOption {
+	return func(s *Server) {
+		s.middlewares = append(s.middlewares, middlewares...)
+	}
+}
+
+// WithHandler replaces handler passed to the constructor, e.g. to change default handler of predefined servers
+func WithHandler(handler http.Handler) ServerOption {
+	return func(s *Server) {
+		s.handler = handler
+	}
 }
 
-func NewServer(name, port string, handler http.Handler) (*Server, error) {
-	ln, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+func NewServer(name, port string, handler http.Handler, opts ...ServerOption) (*Server, error) {
+	return NewServerWithConfig(name, ServerConfig{Port: port}, handler, opts...)
+}
+
+// NewServerWithConfig creates server which serves TLS when certificate is configured.
+// Certificate and client CA files are reloaded when they are changed on disk.
+func NewServerWithConfig(name string, cfg ServerConfig, handler http.Handler, opts ...ServerOption) (*Server, error) {
+	cfg.setDefaults()
+	var certs *certReloader
+	if cfg.TLS.Enabled() {
+		var err error
+		certs, err = newCertReloader(cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("error configuring tls: %w", err)
+		}
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.Port))
 	if err != nil {
 		return nil, fmt.Errorf("cannot listen server port: %w", err)
 	}
-	return &Server{
+	if cfg.MaxConnections > 0 {
+		ln = newLimitListener(name, ln, cfg.MaxConnections)
+	}
+	s := &Server{
 		name:     name,
-		server:   &http.Server{Handler: handler},
+		log:      logging.Component(name + "_server"),
 		listener: ln,
-	}, nil
+		certs:    certs,
+
+		shutdownTimeout: cfg.ShutdownTimeout,
+		handler:         handler,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	handler = middleware.Chain(s.handler, s.middlewares...)
+	if cfg.MaxInFlight > 0 {
+		handler = limitInFlight(name, handler, cfg.MaxInFlight, cfg.RetryAfter)
+	}
+	httpServer := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		ErrorLog:          log.New(&handshakeErrorWriter{server: name, log: s.log}, "", 0),
+	}
+	if certs != nil {
+		httpServer.TLSConfig = certs.TLSConfig()
+	}
+	s.server = httpServer
+	return s, nil
 }
 
 func (s *Server) Run(ctx context.Context) {
 	go func() {
-		logrus.Infof("starting %v server on %s", s.name, s.listener.Addr().String())
-		err := s.server.Serve(s.listener)
+		var err error
+		if s.certs != nil {
+			s.log.Infof("starting %v server with tls on %s", s.name, s.listener.Addr().String())
+			err = s.server.ServeTLS(s.listener, "", "")
+		} else {
+			s.log.Infof("starting %v server on %s", s.name, s.listener.Addr().String())
+			err = s.server.Serve(s.listener)
+		}
 		if err != nil && err != http.ErrServerClosed {
-			logrus.Errorf("error serving %v web: %+v", s.name, err)
+			s.log.Errorf("error serving %v web: %+v", s.name, err)
 		}
 	}()
+	if s.certs != nil {
+		go s.reloadCertificates(ctx)
+	}
 
 	<-ctx.Done()
 	{
 		// shutdown
-		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
 		defer cancel()
 		err := s.server.Shutdown(ctx)
 		if err != nil {
-			logrus.Infof("error shutting down http server: %v", err)
+			s.log.Infof("error shutting down http server: %v", err)
+		}
+	}
+}
+
+func (s *Server) reloadCertificates(ctx context.Context) {
+	interval := s.certs.cfg.ReloadInterval
+	if interval <= 0 {
+		interval = defaultCertReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := s.certs.reloadIfChanged()
+			if err != nil {
+				s.log.Errorf("error reloading tls certificates, keeping previous: %v", err)
+			} else if reloaded {
+				s.log.Infof("tls certificates reloaded")
+			}
 		}
 	}
 }
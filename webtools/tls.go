@@ -0,0 +1,213 @@
+package webtools
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/einherij/enterprise/logging"
+)
+
+const defaultCertReloadInterval = time.Minute
+
+var tlsHandshakeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_server_tls_handshake_errors_total",
+	Help: "Number of failed TLS handshakes.",
+}, []string{"server"})
+
+type TLSConfig struct {
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// ClientCAFile enables mutual TLS, client certificates are verified with the CA
+	ClientCAFile string `mapstructure:"client_ca_file"`
+	// MinVersion is one of 1.0, 1.1, 1.2, 1.3
+	MinVersion string `mapstructure:"min_version" default:"1.2" validate:"oneof=1.0 1.1 1.2 1.3"`
+	// CipherSuites are names of crypto/tls cipher suites, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	CipherSuites []string `mapstructure:"cipher_suites"`
+	// ReloadInterval is how often certificate files are checked for rotation
+	ReloadInterval time.Duration `mapstructure:"reload_interval" default:"1m"`
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certReloader serves certificates and client CA loaded from files and reloads them when files are changed
+type certReloader struct {
+	cfg  TLSConfig
+	base *tls.Config
+
+	mux       sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  []time.Time
+}
+
+func newCertReloader(cfg TLSConfig) (*certReloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("both tls cert_file and key_file are required")
+	}
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.MinVersion != "" {
+		version, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls version %q", cfg.MinVersion)
+		}
+		base.MinVersion = version
+	}
+	for _, name := range cfg.CipherSuites {
+		id, err := cipherSuiteID(name)
+		if err != nil {
+			return nil, err
+		}
+		base.CipherSuites = append(base.CipherSuites, id)
+	}
+	if cfg.ClientCAFile != "" {
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r := &certReloader{
+		cfg:  cfg,
+		base: base,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func cipherSuiteID(name string) (uint16, error) {
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, suite := range suites {
+			if suite.Name == name {
+				return suite.ID, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unknown tls cipher suite %q", name)
+}
+
+// TLSConfig returns config which takes the current certificate and client CA on every handshake
+func (r *certReloader) TLSConfig() *tls.Config {
+	cfg := r.base.Clone()
+	cfg.GetCertificate = r.getCertificate
+	// http.Server adds protocols to its own copy of the config, which isn't visible to GetConfigForClient
+	cfg.NextProtos = []string{"h2", "http/1.1"}
+	if r.cfg.ClientCAFile == "" {
+		return cfg
+	}
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		clientCfg := cfg.Clone()
+		clientCfg.GetConfigForClient = nil
+		r.mux.RLock()
+		clientCfg.ClientCAs = r.clientCAs
+		r.mux.RUnlock()
+		return clientCfg, nil
+	}
+	return cfg
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) files() []string {
+	var files = []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+// reloadIfChanged reloads files if modification time of any file is changed
+func (r *certReloader) reloadIfChanged() (bool, error) {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return false, err
+	}
+	r.mux.RLock()
+	var changed = len(modTimes) != len(r.modTimes)
+	for i := 0; !changed && i < len(modTimes); i++ {
+		changed = !modTimes[i].Equal(r.modTimes[i])
+	}
+	r.mux.RUnlock()
+	if !changed {
+		return false, nil
+	}
+	return true, r.reload()
+}
+
+func (r *certReloader) fileModTimes() ([]time.Time, error) {
+	var modTimes []time.Time
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("error checking tls file: %w", err)
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+func (r *certReloader) reload() error {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("error loading tls certificate: %w", err)
+	}
+	var clientCAs *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("error reading client CA: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return errors.New("no certificates found in client CA file")
+		}
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	return nil
+}
+
+// handshakeErrorWriter is used as http.Server error log to count TLS handshake errors
+type handshakeErrorWriter struct {
+	server string
+	log    logging.Logger
+}
+
+func (w *handshakeErrorWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	if strings.Contains(msg, "TLS handshake error") {
+		tlsHandshakeErrors.WithLabelValues(w.server).Inc()
+	}
+	w.log.Warn(msg)
+	return len(p), nil
+}
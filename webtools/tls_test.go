@@ -0,0 +1,206 @@
+package webtools
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+)
+
+type TLSSuite struct {
+	suite.Suite
+
+	dir string
+	ca  *x509.Certificate
+	key *ecdsa.PrivateKey
+}
+
+func TestTLSSuite(t *testing.T) {
+	suite.Run(t, new(TLSSuite))
+}
+
+func (s *TLSSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.ca, s.key = s.newCert("test ca", nil, nil)
+	s.writePEM("ca.pem", "CERTIFICATE", s.ca.Raw)
+}
+
+// newCert creates certificate signed by parent, or self-signed CA when parent is nil
+func (s *TLSSuite) newCert(name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.Require().NoError(err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	s.Require().NoError(err)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	s.Require().NoError(err)
+	cert, err := x509.ParseCertificate(der)
+	s.Require().NoError(err)
+	return cert, key
+}
+
+func (s *TLSSuite) writePEM(name, blockType string, der []byte) string {
+	path := filepath.Join(s.dir, name)
+	s.Require().NoError(os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+	return path
+}
+
+func (s *TLSSuite) writeServerCert(name string) {
+	cert, key := s.newCert(name, s.ca, s.key)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	s.Require().NoError(err)
+	s.writePEM("server.pem", "CERTIFICATE", cert.Raw)
+	s.writePEM("server.key", "EC PRIVATE KEY", keyDER)
+}
+
+func (s *TLSSuite) clientCert() tls.Certificate {
+	cert, key := s.newCert("client", s.ca, s.key)
+	return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}
+}
+
+func (s *TLSSuite) tlsConfig() TLSConfig {
+	return TLSConfig{
+		CertFile:       filepath.Join(s.dir, "server.pem"),
+		KeyFile:        filepath.Join(s.dir, "server.key"),
+		MinVersion:     "1.2",
+		ReloadInterval: 10 * time.Millisecond,
+	}
+}
+
+func (s *TLSSuite) runServer(name string, cfg TLSConfig) string {
+	server, err := NewServerWithConfig(name, ServerConfig{Port: "0", TLS: cfg}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	s.Require().NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.T().Cleanup(cancel)
+	go server.Run(ctx)
+	return "https://" + server.Addr().String()
+}
+
+func (s *TLSSuite) client(certs ...tls.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.ca)
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs, ServerName: "localhost"},
+	}}
+}
+
+func (s *TLSSuite) TestServeTLS() {
+	s.writeServerCert("first")
+	url := s.runServer("tls_serve", s.tlsConfig())
+
+	resp, err := s.client().Get(url)
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("first", resp.TLS.PeerCertificates[0].Subject.CommonName)
+}
+
+func (s *TLSSuite) TestReloadCertificate() {
+	s.writeServerCert("first")
+	url := s.runServer("tls_reload", s.tlsConfig())
+
+	s.writeServerCert("second")
+	// make mod time differ on file systems with coarse timestamps
+	future := time.Now().Add(time.Minute)
+	s.Require().NoError(os.Chtimes(filepath.Join(s.dir, "server.pem"), future, future))
+
+	s.Eventually(func() bool {
+		client := s.client()
+		defer client.CloseIdleConnections()
+		resp, err := client.Get(url)
+		if err != nil {
+			return false
+		}
+		_ = resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].Subject.CommonName == "second"
+	}, time.Second, 20*time.Millisecond)
+}
+
+func (s *TLSSuite) TestMutualTLS() {
+	s.writeServerCert("server")
+	cfg := s.tlsConfig()
+	cfg.ClientCAFile = filepath.Join(s.dir, "ca.pem")
+	url := s.runServer("tls_mutual", cfg)
+	handshakeErrors := testutil.ToFloat64(tlsHandshakeErrors.WithLabelValues("tls_mutual"))
+
+	_, err := s.client().Get(url)
+	s.Error(err)
+	s.Eventually(func() bool {
+		return testutil.ToFloat64(tlsHandshakeErrors.WithLabelValues("tls_mutual")) == handshakeErrors+1
+	}, time.Second, 10*time.Millisecond)
+
+	resp, err := s.client(s.clientCert()).Get(url)
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+	s.Equal(http.StatusOK, resp.StatusCode)
+}
+
+func (s *TLSSuite) TestHTTP2() {
+	s.writeServerCert("server")
+	cfg := s.tlsConfig()
+	plainURL := s.runServer("tls_http2", cfg)
+	cfg.ClientCAFile = filepath.Join(s.dir, "ca.pem")
+	mutualURL := s.runServer("tls_http2_mutual", cfg)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(s.ca)
+	for _, url := range []string{plainURL, mutualURL} {
+		conn, err := tls.Dial("tcp", strings.TrimPrefix(url, "https://"), &tls.Config{
+			RootCAs:      pool,
+			Certificates: []tls.Certificate{s.clientCert()},
+			ServerName:   "localhost",
+			NextProtos:   []string{"h2", "http/1.1"},
+		})
+		s.Require().NoError(err, url)
+		s.Equal("h2", conn.ConnectionState().NegotiatedProtocol, url)
+		s.NoError(conn.Close())
+	}
+}
+
+func (s *TLSSuite) TestInvalidConfig() {
+	s.writeServerCert("server")
+
+	cfg := s.tlsConfig()
+	cfg.MinVersion = "0.9"
+	_, err := NewServerWithConfig("tls_invalid", ServerConfig{Port: "0", TLS: cfg}, http.NotFoundHandler())
+	s.Error(err)
+
+	cfg = s.tlsConfig()
+	cfg.CipherSuites = []string{"TLS_UNKNOWN"}
+	_, err = NewServerWithConfig("tls_invalid", ServerConfig{Port: "0", TLS: cfg}, http.NotFoundHandler())
+	s.Error(err)
+
+	cfg = s.tlsConfig()
+	cfg.KeyFile = ""
+	_, err = NewServerWithConfig("tls_invalid", ServerConfig{Port: "0", TLS: cfg}, http.NotFoundHandler())
+	s.Error(err)
+}
@@ -0,0 +1,108 @@
+package webservers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/einherij/enterprise"
+	"github.com/einherij/enterprise/health"
+	"github.com/einherij/enterprise/logging"
+	"github.com/einherij/enterprise/utils"
+	"github.com/einherij/enterprise/webtools"
+)
+
+// AdminConfig enables all sections of admin server by default
+type AdminConfig struct {
+	Port             string `mapstructure:"port" validate:"required"`
+	DisableMetrics   bool   `mapstructure:"disable_metrics"`
+	DisablePProf     bool   `mapstructure:"disable_pprof"`
+	DisableHealth    bool   `mapstructure:"disable_health"`
+	DisableBuildInfo bool   `mapstructure:"disable_build_info"`
+	DisableRunners   bool   `mapstructure:"disable_runners"`
+	DisableLogLevel  bool   `mapstructure:"disable_log_level"`
+}
+
+// NewAdminServer serves /metrics, /debug/pprof/*, /livez, /readyz, /buildinfo, /runners and /loglevel on a single port.
+// Health reports and runners list are taken from app, if app is nil health.DefaultRegistry is used
+// and runners list isn't served.
+func NewAdminServer(cfg AdminConfig, app *enterprise.App, opts ...webtools.ServerOption) (*webtools.Server, error) {
+	srv, err := webtools.NewServerWithConfig("admin", profilingServerConfig(cfg.Port), newAdminMux(cfg, app), opts...)
+	if err != nil {
+		return srv, fmt.Errorf("error creating admin server: %w", err)
+	}
+	return srv, nil
+}
+
+func newAdminMux(cfg AdminConfig, app *enterprise.App) *http.ServeMux {
+	mux := http.NewServeMux()
+	if !cfg.DisableMetrics {
+		mux.Handle("/metrics", newMetricsHandler())
+	}
+	if !cfg.DisablePProf {
+		registerPProf(mux)
+	}
+	if !cfg.DisableHealth {
+		registry := health.DefaultRegistry
+		if app != nil {
+			registry = app.HealthRegistry()
+		}
+		mux.Handle("/livez", registry.LivenessHandler())
+		mux.Handle("/readyz", registry.ReadinessHandler())
+	}
+	if !cfg.DisableBuildInfo {
+		mux.HandleFunc("/buildinfo", serveBuildInfo)
+	}
+	if !cfg.DisableRunners && app != nil {
+		mux.HandleFunc("/runners", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, app.Runners())
+		})
+	}
+	if !cfg.DisableLogLevel {
+		mux.Handle("/loglevel", logging.Default.Handler())
+	}
+	return mux
+}
+
+type buildInfo struct {
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path"`
+	Main      module            `json:"main"`
+	Deps      []module          `json:"deps"`
+	Settings  map[string]string `json:"settings"`
+}
+
+type module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Sum     string `json:"sum,omitempty"`
+}
+
+func serveBuildInfo(w http.ResponseWriter, _ *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		http.Error(w, "build info is not available", http.StatusNotFound)
+		return
+	}
+	resp := buildInfo{
+		GoVersion: info.GoVersion,
+		Path:      info.Path,
+		Main:      module{Path: info.Main.Path, Version: info.Main.Version, Sum: info.Main.Sum},
+		Settings:  make(map[string]string, len(info.Settings)),
+	}
+	for _, dep := range info.Deps {
+		resp.Deps = append(resp.Deps, module{Path: dep.Path, Version: dep.Version, Sum: dep.Sum})
+	}
+	for _, setting := range info.Settings {
+		resp.Settings[setting.Key] = setting.Value
+	}
+	writeJSON(w, resp)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	utils.SetContentTypeHeader(w, utils.ContentTypeApplicationJSON)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Component("admin_server").Warnf("error writing response: %v", err)
+	}
+}
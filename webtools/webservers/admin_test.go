@@ -0,0 +1,117 @@
+package webservers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/einherij/enterprise"
+	"github.com/einherij/enterprise/health"
+	"github.com/einherij/enterprise/webtools"
+)
+
+type AdminServerSuite struct {
+	suite.Suite
+
+	app      *enterprise.App
+	cancel   context.CancelFunc
+	endpoint string
+}
+
+func TestAdminServerSuite(t *testing.T) {
+	suite.Run(t, new(AdminServerSuite))
+}
+
+func (s *AdminServerSuite) SetupTest() {
+	s.app = enterprise.NewApplication(enterprise.WithHealthRegistry(health.NewRegistry()))
+	s.app.RegisterNamedRunner("http", enterprise.RunnerFunc(nil, nil))
+}
+
+func (s *AdminServerSuite) TearDownTest() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+func (s *AdminServerSuite) runServer(cfg AdminConfig) {
+	cfg.Port = "0"
+	serv, err := NewAdminServer(cfg, s.app)
+	s.Require().NoError(err)
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	go serv.Run(ctx)
+	s.endpoint = "http://" + serv.Addr().String()
+}
+
+func (s *AdminServerSuite) get(path string) *http.Response {
+	resp, err := http.Get(s.endpoint + path)
+	s.Require().NoError(err)
+	s.T().Cleanup(func() {
+		_ = resp.Body.Close()
+	})
+	return resp
+}
+
+func (s *AdminServerSuite) TestAllSections() {
+	s.runServer(AdminConfig{})
+
+	for _, path := range []string{
+		"/metrics",
+		"/debug/pprof/",
+		"/debug/pprof/allocs",
+		"/debug/pprof/mutex",
+		"/livez",
+		"/readyz",
+		"/buildinfo",
+		"/runners",
+		"/loglevel",
+	} {
+		s.Equal(http.StatusOK, s.get(path).StatusCode, path)
+	}
+}
+
+func (s *AdminServerSuite) TestNoWriteTimeout() {
+	// profile and trace are written after the requested duration, which can be longer than default write timeout
+	writeTimeouts := make(chan time.Duration, 1)
+	serv, err := NewAdminServer(AdminConfig{Port: "0"}, s.app, webtools.WithMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeTimeouts <- r.Context().Value(http.ServerContextKey).(*http.Server).WriteTimeout
+			next.ServeHTTP(w, r)
+		})
+	}))
+	s.Require().NoError(err)
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	go serv.Run(ctx)
+	s.endpoint = "http://" + serv.Addr().String()
+
+	s.Equal(http.StatusOK, s.get("/debug/pprof/").StatusCode)
+	s.Zero(<-writeTimeouts)
+}
+
+func (s *AdminServerSuite) TestRunners() {
+	s.runServer(AdminConfig{})
+
+	var runners []enterprise.RunnerInfo
+	s.NoError(json.NewDecoder(s.get("/runners").Body).Decode(&runners))
+	s.Equal([]enterprise.RunnerInfo{{Name: "http", Critical: true, Status: enterprise.RunnerRegistered}}, runners)
+}
+
+func (s *AdminServerSuite) TestDisabledSections() {
+	s.runServer(AdminConfig{
+		DisableMetrics:   true,
+		DisablePProf:     true,
+		DisableHealth:    true,
+		DisableBuildInfo: true,
+		DisableRunners:   true,
+		DisableLogLevel:  true,
+	})
+
+	for _, path := range []string{"/metrics", "/debug/pprof/", "/livez", "/readyz", "/buildinfo", "/runners", "/loglevel"} {
+		s.Equal(http.StatusNotFound, s.get(path).StatusCode, path)
+	}
+}
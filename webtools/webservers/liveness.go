@@ -5,27 +5,47 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/einherij/enterprise/health"
 	"github.com/einherij/enterprise/webtools"
 )
 
 type LivenessConfig struct {
-	LivenessPort string `mapstructure:"liveness_port"`
+	LivenessPort string `mapstructure:"liveness_port" validate:"required"`
 }
 
-func NewLivenessServer(cfg LivenessConfig) (*webtools.Server, error) {
+// NewLivenessServer serves /livez and /readyz reports of health.DefaultRegistry or registry set by WithHealthRegistry.
+// Paths starting with /health are kept for compatibility and respond with liveness report.
+func NewLivenessServer(cfg LivenessConfig, opts ...webtools.ServerOption) (*webtools.Server, error) {
 	srv, err := webtools.NewServer(
 		"liveness_probe",
 		cfg.LivenessPort,
-		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if strings.HasPrefix(r.URL.Path, "/health") {
-				w.WriteHeader(http.StatusOK)
-			} else {
-				w.WriteHeader(http.StatusNotFound)
-			}
-		}),
+		newHealthMux(health.DefaultRegistry),
+		opts...,
 	)
 	if err != nil {
 		return srv, fmt.Errorf("error creating liveness probe server: %w", err)
 	}
 	return srv, nil
 }
+
+// WithHealthRegistry makes liveness server report checks of the registry instead of health.DefaultRegistry
+func WithHealthRegistry(registry *health.Registry) webtools.ServerOption {
+	return webtools.WithHandler(newHealthMux(registry))
+}
+
+func newHealthMux(registry *health.Registry) http.Handler {
+	var (
+		livenessHandler  = registry.LivenessHandler()
+		readinessHandler = registry.ReadinessHandler()
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/livez" || strings.HasPrefix(r.URL.Path, "/health"):
+			livenessHandler.ServeHTTP(w, r)
+		case r.URL.Path == "/readyz":
+			readinessHandler.ServeHTTP(w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
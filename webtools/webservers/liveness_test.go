@@ -0,0 +1,66 @@
+package webservers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/einherij/enterprise/health"
+)
+
+type LivenessServerSuite struct {
+	suite.Suite
+
+	cancel context.CancelFunc
+}
+
+func TestLivenessServerSuite(t *testing.T) {
+	suite.Run(t, new(LivenessServerSuite))
+}
+
+func (s *LivenessServerSuite) TearDownTest() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+func (s *LivenessServerSuite) TestRegistry() {
+	registry := health.NewRegistry()
+	registry.Register("db", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	serv, err := NewLivenessServer(LivenessConfig{LivenessPort: "0"}, WithHealthRegistry(registry))
+	s.Require().NoError(err)
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	go serv.Run(ctx)
+	endpoint := "http://" + serv.Addr().String()
+
+	for path, status := range map[string]int{
+		"/livez":  http.StatusOK,
+		"/health": http.StatusOK,
+		"/readyz": http.StatusServiceUnavailable,
+		"/other":  http.StatusNotFound,
+	} {
+		resp, err := http.Get(endpoint + path)
+		s.Require().NoError(err)
+		s.NoError(resp.Body.Close())
+		s.Equal(status, resp.StatusCode, path)
+	}
+}
+
+func (s *LivenessServerSuite) TestDefaultRegistry() {
+	serv, err := NewLivenessServer(LivenessConfig{LivenessPort: "0"})
+	s.Require().NoError(err)
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	go serv.Run(ctx)
+
+	resp, err := http.Get("http://" + serv.Addr().String() + "/livez")
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+	s.Equal(http.StatusOK, resp.StatusCode)
+}
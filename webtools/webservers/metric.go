@@ -4,25 +4,27 @@ import (
 	"errors"
 	"net/http"
 
-	"github.com/sirupsen/logrus"
-
+	"github.com/einherij/enterprise/logging"
 	"github.com/einherij/enterprise/webtools"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type MetricsConfig struct {
-	Port string `mapstructure:"port"`
+	Port string `mapstructure:"port" validate:"required"`
 }
 
-func NewMetricServer(cfg MetricsConfig) (*webtools.Server, error) {
-	promHTTPHandler := promhttp.InstrumentMetricHandler(
+func NewMetricServer(cfg MetricsConfig, opts ...webtools.ServerOption) (*webtools.Server, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", newMetricsHandler())
+
+	return webtools.NewServer("metrics", cfg.Port, mux, opts...)
+}
+
+func newMetricsHandler() http.Handler {
+	return promhttp.InstrumentMetricHandler(
 		prometheus.DefaultRegisterer, promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
-			ErrorLog: logrus.StandardLogger().WithError(errors.New("prometheus handler error")),
+			ErrorLog: logging.Component("metrics_server").WithError(errors.New("prometheus handler error")),
 		}),
 	)
-	mux := http.NewServeMux()
-	mux.Handle("/metrics", promHTTPHandler)
-
-	return webtools.NewServer("metrics", cfg.Port, mux)
 }
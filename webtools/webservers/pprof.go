@@ -4,27 +4,41 @@ import (
 	"net/http"
 	"net/http/pprof"
 
+	"github.com/einherij/enterprise/logging"
 	"github.com/einherij/enterprise/webtools"
 )
 
 type PProfConfig struct {
-	Port string `mapstructure:"port"`
+	Port string `mapstructure:"port" validate:"required"`
 }
 
-func NewPProfServer(cfg PProfConfig) (*webtools.Server, error) {
-	return webtools.NewServer("pprof", cfg.Port, newPProfMux())
+// NewPProfServer serves pprof profiles and /loglevel endpoint of the default logging manager
+func NewPProfServer(cfg PProfConfig, opts ...webtools.ServerOption) (*webtools.Server, error) {
+	return webtools.NewServerWithConfig("pprof", profilingServerConfig(cfg.Port), newPProfMux(), opts...)
+}
+
+// profilingServerConfig disables write timeout, CPU profile and trace are written after the requested duration
+func profilingServerConfig(port string) webtools.ServerConfig {
+	return webtools.ServerConfig{Port: port, WriteTimeout: -1}
 }
 
 func newPProfMux() *http.ServeMux {
 	pprofMux := http.NewServeMux()
-	pprofMux.HandleFunc("/debug/pprof/", pprof.Index)
-	pprofMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-	pprofMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
-	pprofMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-	pprofMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
-	pprofMux.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
-	pprofMux.Handle("/debug/pprof/heap", pprof.Handler("heap"))
-	pprofMux.Handle("/debug/pprof/threadcreate", pprof.Handler("threadcreate"))
-	pprofMux.Handle("/debug/pprof/block", pprof.Handler("block"))
+	registerPProf(pprofMux)
+	pprofMux.Handle("/loglevel", logging.Default.Handler())
 	return pprofMux
 }
+
+func registerPProf(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/pprof/allocs", pprof.Handler("allocs"))
+	mux.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
+	mux.Handle("/debug/pprof/heap", pprof.Handler("heap"))
+	mux.Handle("/debug/pprof/mutex", pprof.Handler("mutex"))
+	mux.Handle("/debug/pprof/threadcreate", pprof.Handler("threadcreate"))
+	mux.Handle("/debug/pprof/block", pprof.Handler("block"))
+}